@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Locker adapt m to sync.Locker
+func Locker(m Mutex) sync.Locker {
+	return locker{m}
+}
+
+type locker struct {
+	Mutex
+}
+
+func (l locker) Unlock() {
+	l.UnLock()
+}
+
+// condition variable of Mutex, the mutex must be held when calling Wait
+// methods, it is unlocked while waiting and locked again before return
+type Cond interface {
+	Wait()
+	// WaitContext return true if signaled, return false if context done
+	WaitContext(ctx context.Context) bool
+	// WaitTimeout return true if signaled, return false if timeout
+	WaitTimeout(timeout time.Duration) bool
+	// Signal wake up one waiter
+	Signal()
+	// Broadcast wake up all waiters
+	Broadcast()
+}
+
+func NewCond(m Mutex) Cond {
+	return &cond{m: m}
+}
+
+type cond struct {
+	m       Mutex
+	mu      sync.Mutex
+	waiters list.List
+}
+
+func (c *cond) wait(done <-chan struct{}) bool {
+	ch := make(chan struct{})
+	c.mu.Lock()
+	elem := c.waiters.PushBack(ch)
+	c.mu.Unlock()
+
+	c.m.UnLock()
+	defer c.m.Lock()
+
+	select {
+	case <-ch:
+		return true
+	case <-done:
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-ch:
+		// signaled while leaving, don't lose it
+		return true
+	default:
+	}
+	c.waiters.Remove(elem)
+	return false
+}
+
+func (c *cond) Wait() {
+	c.wait(nil)
+}
+
+func (c *cond) WaitContext(ctx context.Context) bool {
+	return c.wait(ctx.Done())
+}
+
+func (c *cond) WaitTimeout(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.wait(ctx.Done())
+}
+
+func (c *cond) Signal() {
+	c.mu.Lock()
+	if front := c.waiters.Front(); front != nil {
+		close(c.waiters.Remove(front).(chan struct{}))
+	}
+	c.mu.Unlock()
+}
+
+func (c *cond) Broadcast() {
+	c.mu.Lock()
+	for front := c.waiters.Front(); front != nil; front = c.waiters.Front() {
+		close(c.waiters.Remove(front).(chan struct{}))
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocker(t *testing.T) {
+	mu := NewMutex()
+	l := Locker(mu)
+	l.Lock()
+	if mu.TryLock() {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	l.Unlock()
+
+	// works with sync.Cond
+	c := sync.NewCond(l)
+	ready := false
+	go func() {
+		l.Lock()
+		ready = true
+		l.Unlock()
+		c.Signal()
+	}()
+	l.Lock()
+	for !ready {
+		c.Wait()
+	}
+	l.Unlock()
+}
+
+func TestCondSignal(t *testing.T) {
+	mu := NewMutex()
+	c := NewCond(mu)
+	queue := 0
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		queue++
+		mu.UnLock()
+		c.Signal()
+	}()
+
+	mu.Lock()
+	for queue == 0 {
+		if !c.WaitTimeout(time.Second) {
+			t.Fatalf("should be signaled !!!")
+		}
+	}
+	queue--
+	mu.UnLock()
+}
+
+func TestCondBroadcast(t *testing.T) {
+	mu := NewMutex()
+	c := NewCond(mu)
+	var wg sync.WaitGroup
+	done := false
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			for !done {
+				c.Wait()
+			}
+			mu.UnLock()
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	mu.Lock()
+	done = true
+	mu.UnLock()
+	c.Broadcast()
+	wg.Wait()
+}
+
+func TestCondWaitContext(t *testing.T) {
+	mu := NewMutex()
+	c := NewCond(mu)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	mu.Lock()
+	if c.WaitContext(ctx) {
+		t.Errorf("cannot be signaled !!!")
+	}
+	// mutex is held again after wait
+	if mu.TryLock() {
+		t.Errorf("mutex should be held after wait !!!")
+	}
+	mu.UnLock()
+
+	if n := c.(*cond).waiters.Len(); n != 0 {
+		t.Errorf("cancelled waiter should leave, got %d", n)
+	}
+}
@@ -0,0 +1,246 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Holder describe the goroutine holding a lock in debug mode
+type Holder struct {
+	// Key of the lock in group, nil for a single mutex
+	Key       interface{}
+	Goroutine int64
+	Stack     string
+	Acquired  time.Time
+}
+
+type DebugOptions struct {
+	// Threshold of holding time to report by OnLongHold, zero disable report
+	Threshold time.Duration
+	// OnLongHold is called once when a lock is held longer than Threshold
+	OnLongHold func(Holder)
+	// OnBug is called on misuse like unlock of unlocked mutex,
+	// fallback to PanicOnBug if nil
+	OnBug func(msg string)
+}
+
+// mutex record the holder's stack and acquisition time
+type DebugMutex interface {
+	Mutex
+	// Holders return a snapshot of current holders
+	Holders() []Holder
+}
+
+type DebugMutexGroup interface {
+	MutexGroup
+	// Holders return a snapshot of current holders ordered by acquisition time
+	Holders() []Holder
+}
+
+func NewDebugMutex(opts DebugOptions) DebugMutex {
+	return &debugMutex{mu: NewMutex(), tracker: newTracker(opts)}
+}
+
+func NewDebugMutexGroup(opts DebugOptions) DebugMutexGroup {
+	return &debugMutexGroup{group: NewMutexGroup(), tracker: newTracker(opts)}
+}
+
+type tracker struct {
+	opts    DebugOptions
+	mu      sync.Mutex
+	holders map[interface{}]*tracked
+}
+
+type tracked struct {
+	holder Holder
+	timer  *time.Timer
+}
+
+func newTracker(opts DebugOptions) *tracker {
+	return &tracker{opts: opts, holders: make(map[interface{}]*tracked)}
+}
+
+// track must be called by the goroutine which fetch the lock
+func (t *tracker) track(i interface{}) {
+	stack := make([]byte, 4096)
+	stack = stack[:runtime.Stack(stack, false)]
+
+	h := Holder{
+		Key:       i,
+		Goroutine: goroutineID(stack),
+		Stack:     string(stack),
+		Acquired:  time.Now(),
+	}
+	tr := &tracked{holder: h}
+	if t.opts.Threshold > 0 && t.opts.OnLongHold != nil {
+		tr.timer = time.AfterFunc(t.opts.Threshold, func() {
+			t.opts.OnLongHold(h)
+		})
+	}
+
+	t.mu.Lock()
+	t.holders[i] = tr
+	t.mu.Unlock()
+}
+
+// untrack return false if the lock is not held
+func (t *tracker) untrack(i interface{}) bool {
+	t.mu.Lock()
+	tr, ok := t.holders[i]
+	delete(t.holders, i)
+	t.mu.Unlock()
+
+	if !ok {
+		t.bug("unlock of unlocked mutex")
+		return false
+	}
+	if tr.timer != nil {
+		tr.timer.Stop()
+	}
+	return true
+}
+
+func (t *tracker) bug(msg string) {
+	if t.opts.OnBug != nil {
+		t.opts.OnBug(msg)
+		return
+	}
+	bug(msg)
+}
+
+func (t *tracker) snapshot() []Holder {
+	t.mu.Lock()
+	holders := make([]Holder, 0, len(t.holders))
+	for _, tr := range t.holders {
+		holders = append(holders, tr.holder)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(holders, func(a, b int) bool {
+		return holders[a].Acquired.Before(holders[b].Acquired)
+	})
+	return holders
+}
+
+// goroutineID parse the id from "goroutine 18 [running]:"
+func goroutineID(stack []byte) int64 {
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		id, _ := strconv.ParseInt(string(stack[:i]), 10, 64)
+		return id
+	}
+	return 0
+}
+
+type debugMutex struct {
+	mu      Mutex
+	tracker *tracker
+}
+
+func (m *debugMutex) Lock() {
+	m.mu.Lock()
+	m.tracker.track(nil)
+}
+
+func (m *debugMutex) UnLock() {
+	if m.tracker.untrack(nil) {
+		m.mu.UnLock()
+	}
+}
+
+func (m *debugMutex) TryLock() bool {
+	if m.mu.TryLock() {
+		m.tracker.track(nil)
+		return true
+	}
+	return false
+}
+
+func (m *debugMutex) TryLockTimeout(timeout time.Duration) bool {
+	if m.mu.TryLockTimeout(timeout) {
+		m.tracker.track(nil)
+		return true
+	}
+	return false
+}
+
+func (m *debugMutex) TryLockContext(ctx context.Context) bool {
+	if m.mu.TryLockContext(ctx) {
+		m.tracker.track(nil)
+		return true
+	}
+	return false
+}
+
+func (m *debugMutex) Holders() []Holder {
+	return m.tracker.snapshot()
+}
+
+type debugMutexGroup struct {
+	group   MutexGroup
+	tracker *tracker
+}
+
+func (m *debugMutexGroup) Lock(i interface{}) {
+	m.group.Lock(i)
+	m.tracker.track(i)
+}
+
+func (m *debugMutexGroup) UnLock(i interface{}) {
+	if m.tracker.untrack(i) {
+		m.group.UnLock(i)
+	}
+}
+
+func (m *debugMutexGroup) UnLockAndFree(i interface{}) {
+	m.UnLock(i)
+}
+
+func (m *debugMutexGroup) TryLock(i interface{}) bool {
+	if m.group.TryLock(i) {
+		m.tracker.track(i)
+		return true
+	}
+	return false
+}
+
+func (m *debugMutexGroup) TryLockTimeout(i interface{}, timeout time.Duration) bool {
+	if m.group.TryLockTimeout(i, timeout) {
+		m.tracker.track(i)
+		return true
+	}
+	return false
+}
+
+func (m *debugMutexGroup) TryLockContext(i interface{}, ctx context.Context) bool {
+	if m.group.TryLockContext(i, ctx) {
+		m.tracker.track(i)
+		return true
+	}
+	return false
+}
+
+func (m *debugMutexGroup) LockAll(keys ...interface{}) UnLockFunc {
+	return lockAll(m, keys)
+}
+
+func (m *debugMutexGroup) TryLockAll(keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAll(m, keys, m.TryLock)
+}
+
+func (m *debugMutexGroup) TryLockAllTimeout(timeout time.Duration, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllTimeout(m, keys, timeout)
+}
+
+func (m *debugMutexGroup) TryLockAllContext(ctx context.Context, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllContext(m, keys, ctx)
+}
+
+func (m *debugMutexGroup) Holders() []Holder {
+	return m.tracker.snapshot()
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugMutexHolders(t *testing.T) {
+	mu := NewDebugMutex(DebugOptions{})
+	if len(mu.Holders()) != 0 {
+		t.Errorf("should have no holder !!!")
+	}
+	mu.Lock()
+	holders := mu.Holders()
+	if len(holders) != 1 {
+		t.Fatalf("should have one holder !!!")
+	}
+	if holders[0].Goroutine == 0 || !strings.Contains(holders[0].Stack, "TestDebugMutexHolders") {
+		t.Errorf("holder should record goroutine and stack, got %+v", holders[0])
+	}
+	if mu.TryLock() {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	mu.UnLock()
+	if len(mu.Holders()) != 0 {
+		t.Errorf("should have no holder after unlock !!!")
+	}
+}
+
+func TestDebugMutexOnBug(t *testing.T) {
+	var msg string
+	mu := NewDebugMutex(DebugOptions{OnBug: func(m string) { msg = m }})
+	mu.UnLock()
+	if msg != "unlock of unlocked mutex" {
+		t.Errorf("misuse should be reported, got %q", msg)
+	}
+}
+
+func TestDebugMutexGroupLongHold(t *testing.T) {
+	reported := make(chan Holder, 1)
+	mu := NewDebugMutexGroup(DebugOptions{
+		Threshold:  5 * time.Millisecond,
+		OnLongHold: func(h Holder) { reported <- h },
+	})
+
+	// released in time, nothing reported
+	mu.Lock("fast")
+	mu.UnLock("fast")
+
+	mu.Lock("g")
+	if !mu.TryLock("h") {
+		t.Errorf("should fetch mutex of other key !!!")
+	}
+	if len(mu.Holders()) != 2 {
+		t.Errorf("should have two holders !!!")
+	}
+	mu.UnLock("h")
+
+	select {
+	case h := <-reported:
+		if h.Key != "g" {
+			t.Errorf("should report key g, got %v", h.Key)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("long hold should be reported !!!")
+	}
+	mu.UnLock("g")
+	if len(mu.Holders()) != 0 {
+		t.Errorf("should have no holder after unlock !!!")
+	}
+}
@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"sync"
+)
+
+// refGroup keep one lock per key with a count of its holders and waiters,
+// the key is removed once the count drop to zero
+type refGroup struct {
+	mu      sync.Mutex
+	entries map[interface{}]*refEntry
+	create  func() interface{}
+}
+
+type refEntry struct {
+	value interface{}
+	refs  int
+}
+
+func newRefGroup(create func() interface{}) *refGroup {
+	return &refGroup{
+		entries: make(map[interface{}]*refEntry),
+		create:  create,
+	}
+}
+
+// acquire return the lock of key and take a reference on it
+func (g *refGroup) acquire(i interface{}) interface{} {
+	g.mu.Lock()
+	e, ok := g.entries[i]
+	if !ok {
+		e = &refEntry{value: g.create()}
+		g.entries[i] = e
+	}
+	e.refs++
+	g.mu.Unlock()
+	return e.value
+}
+
+// release drop a reference of key and free it if unused
+func (g *refGroup) release(i interface{}) {
+	g.add(i, -1)
+}
+
+// add change the references of key by n and free it if unused
+func (g *refGroup) add(i interface{}, n int64) {
+	g.mu.Lock()
+	if e, ok := g.entries[i]; ok {
+		e.refs += int(n)
+		if e.refs <= 0 {
+			delete(g.entries, i)
+		}
+	}
+	g.mu.Unlock()
+}
+
+// lookup return the lock of key without taking a reference
+func (g *refGroup) lookup(i interface{}) (interface{}, bool) {
+	g.mu.Lock()
+	e, ok := g.entries[i]
+	g.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// try take a reference and keep it only if fn fetch the lock
+func (g *refGroup) try(i interface{}, fn func(interface{}) bool) bool {
+	if fn(g.acquire(i)) {
+		return true
+	}
+	g.release(i)
+	return false
+}
+
+// len return the number of keys in use
+func (g *refGroup) len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.entries)
+}
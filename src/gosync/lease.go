@@ -0,0 +1,492 @@
+package sync
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLeaseLost is returned when a lease is expired or taken by other owner
+var ErrLeaseLost = errors.New("lease lost")
+
+// Lease is a lock of key granted to owner until Expires
+type Lease struct {
+	Key   string
+	Owner string
+	// Token increase on every grant of the key, pass it to the guarded
+	// resource as a fencing token to reject writes of stale holders
+	Token   uint64
+	Expires time.Time
+}
+
+// LeaseStore share leases between processes
+type LeaseStore interface {
+	// Acquire return false if the key is leased by other owner and not expired
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (Lease, bool, error)
+	// Renew extend the lease, return ErrLeaseLost if it is no longer held
+	Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error)
+	// Release free the key if it is still held by the lease
+	Release(ctx context.Context, lease Lease) error
+}
+
+// LeaseTryAcquirer is implemented by stores which can acquire without
+// waiting, TryLock use it instead of Acquire
+type LeaseTryAcquirer interface {
+	// TryAcquire is like Acquire but return false at once if the key is busy
+	TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) (Lease, bool, error)
+}
+
+type LeaseOptions struct {
+	// Owner identify this process, default to hostname-pid-random
+	Owner string
+	// TTL of leases, default to 10s, leases are renewed every TTL/3
+	TTL time.Duration
+	// RetryInterval of acquiring a leased key, default to TTL/10, TryLock
+	// wait a store without TryAcquire up to it
+	RetryInterval time.Duration
+	// OnLost is called when a held lease can not be renewed
+	OnLost func(Lease, error)
+}
+
+// mutex group across processes backed by a LeaseStore, keys must be
+// strings and are used as keys of the store
+type LeaseMutexGroup interface {
+	MutexGroup
+	// Lease return the lease of key held by this group
+	Lease(i interface{}) (Lease, bool)
+}
+
+func NewLeaseMutexGroup(store LeaseStore, opts LeaseOptions) LeaseMutexGroup {
+	if opts.Owner == "" {
+		opts.Owner = defaultOwner()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 10 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = opts.TTL / 10
+	}
+	return &leaseMutexGroup{
+		store:  store,
+		opts:   opts,
+		local:  NewMutexGroup(),
+		leases: make(map[interface{}]*heldLease),
+	}
+}
+
+func defaultOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+type leaseMutexGroup struct {
+	store LeaseStore
+	opts  LeaseOptions
+
+	// serialize goroutines of this process before asking the store
+	local MutexGroup
+
+	mu     sync.Mutex
+	leases map[interface{}]*heldLease
+}
+
+type heldLease struct {
+	mu    sync.Mutex
+	lease Lease
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func (m *leaseMutexGroup) Lock(i interface{}) {
+	m.TryLockContext(i, context.Background())
+}
+
+func (m *leaseMutexGroup) UnLock(i interface{}) {
+	m.mu.Lock()
+	held, ok := m.leases[i]
+	delete(m.leases, i)
+	m.mu.Unlock()
+
+	if !ok {
+		bug("unlock of unlocked mutex")
+		return
+	}
+
+	close(held.stop)
+	<-held.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.TTL)
+	m.store.Release(ctx, held.get())
+	cancel()
+
+	m.local.UnLock(i)
+}
+
+func (m *leaseMutexGroup) UnLockAndFree(i interface{}) {
+	m.UnLock(i)
+}
+
+func (m *leaseMutexGroup) TryLock(i interface{}) bool {
+	key, ok := storeKey(i)
+	if !ok || !m.local.TryLock(i) {
+		return false
+	}
+
+	var lease Lease
+	var err error
+	if store, try := m.store.(LeaseTryAcquirer); try {
+		lease, ok, err = store.TryAcquire(context.Background(), key, m.opts.Owner, m.opts.TTL)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), m.opts.RetryInterval)
+		lease, ok, err = m.store.Acquire(ctx, key, m.opts.Owner, m.opts.TTL)
+		cancel()
+	}
+	if err != nil || !ok {
+		m.local.UnLock(i)
+		return false
+	}
+	m.hold(i, lease)
+	return true
+}
+
+func (m *leaseMutexGroup) TryLockTimeout(i interface{}, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.TryLockContext(i, ctx)
+}
+
+func (m *leaseMutexGroup) TryLockContext(i interface{}, ctx context.Context) bool {
+	key, ok := storeKey(i)
+	if !ok || !m.local.TryLockContext(i, ctx) {
+		return false
+	}
+
+	for {
+		// store errors are retried like a leased key
+		lease, ok, err := m.store.Acquire(ctx, key, m.opts.Owner, m.opts.TTL)
+		if err == nil && ok {
+			m.hold(i, lease)
+			return true
+		}
+
+		select {
+		case <-time.After(m.opts.RetryInterval):
+		case <-ctx.Done():
+			m.local.UnLock(i)
+			return false
+		}
+	}
+}
+
+// storeKey reject keys which are not strings, formatting them could map
+// distinct keys like 1 and "1" to one lease
+func storeKey(i interface{}) (string, bool) {
+	key, ok := i.(string)
+	if !ok {
+		bug(fmt.Sprintf("lease mutex key must be a string, got %T", i))
+	}
+	return key, ok
+}
+
+func (m *leaseMutexGroup) LockAll(keys ...interface{}) UnLockFunc {
+	return lockAll(m, keys)
+}
+
+func (m *leaseMutexGroup) TryLockAll(keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAll(m, keys, m.TryLock)
+}
+
+func (m *leaseMutexGroup) TryLockAllTimeout(timeout time.Duration, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllTimeout(m, keys, timeout)
+}
+
+func (m *leaseMutexGroup) TryLockAllContext(ctx context.Context, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllContext(m, keys, ctx)
+}
+
+func (m *leaseMutexGroup) Lease(i interface{}) (Lease, bool) {
+	m.mu.Lock()
+	held, ok := m.leases[i]
+	m.mu.Unlock()
+	if !ok {
+		return Lease{}, false
+	}
+	return held.get(), true
+}
+
+// hold record the lease and renew it until unlock
+func (m *leaseMutexGroup) hold(i interface{}, lease Lease) {
+	held := &heldLease{
+		lease: lease,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.leases[i] = held
+	m.mu.Unlock()
+
+	go m.renew(held)
+}
+
+func (m *leaseMutexGroup) renew(held *heldLease) {
+	defer close(held.done)
+
+	ticker := time.NewTicker(m.opts.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-held.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.opts.TTL/3)
+		lease, err := m.store.Renew(ctx, held.get(), m.opts.TTL)
+		cancel()
+		if err == nil {
+			held.set(lease)
+			continue
+		}
+		if errors.Is(err, ErrLeaseLost) || time.Now().After(held.get().Expires) {
+			if m.opts.OnLost != nil {
+				m.opts.OnLost(held.get(), err)
+			}
+			return
+		}
+	}
+}
+
+func (h *heldLease) get() Lease {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lease
+}
+
+func (h *heldLease) set(lease Lease) {
+	h.mu.Lock()
+	h.lease = lease
+	h.mu.Unlock()
+}
+
+// grant apply the lease rules on the last known lease of key, a held
+// lease is not granted again even to its owner, it is extended by Renew
+func grant(last Lease, key, owner string, ttl time.Duration, now time.Time) (Lease, bool) {
+	if last.Owner != "" && now.Before(last.Expires) {
+		return last, false
+	}
+	return Lease{
+		Key:     key,
+		Owner:   owner,
+		Token:   last.Token + 1,
+		Expires: now.Add(ttl),
+	}, true
+}
+
+func held(last, lease Lease, now time.Time) bool {
+	return last.Owner == lease.Owner && last.Token == lease.Token && now.Before(last.Expires)
+}
+
+// in-memory LeaseStore, it is shared between groups of one process only
+func NewMemoryLeaseStore() LeaseStore {
+	return &memoryLeaseStore{leases: make(map[string]Lease), now: time.Now}
+}
+
+type memoryLeaseStore struct {
+	mu sync.Mutex
+	// released leases are kept to continue their token
+	leases map[string]Lease
+	now    func() time.Time
+}
+
+func (s *memoryLeaseStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (Lease, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lease, ok := grant(s.leases[key], key, owner, ttl, s.now())
+	if ok {
+		s.leases[key] = lease
+	}
+	return lease, ok, nil
+}
+
+func (s *memoryLeaseStore) Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !held(s.leases[lease.Key], lease, now) {
+		return lease, ErrLeaseLost
+	}
+	lease.Expires = now.Add(ttl)
+	s.leases[lease.Key] = lease
+	return lease, nil
+}
+
+func (s *memoryLeaseStore) Release(ctx context.Context, lease Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := s.leases[lease.Key]
+	if last.Owner != lease.Owner || last.Token != lease.Token {
+		return ErrLeaseLost
+	}
+	last.Owner = ""
+	last.Expires = time.Time{}
+	s.leases[lease.Key] = last
+	return nil
+}
+
+// file LeaseStore keep a JSON file per key in dir, processes sharing
+// the dir are serialized by lock files created exclusively
+func NewFileLeaseStore(dir string) (LeaseStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileLeaseStore{dir: dir, now: time.Now}, nil
+}
+
+type fileLeaseStore struct {
+	dir string
+	now func() time.Time
+}
+
+// a lock file older than it is left by a dead process
+const staleLockFile = 5 * time.Second
+
+func (s *fileLeaseStore) path(key string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(key))+".lease")
+}
+
+// errLockBusy is returned by update without wait when the lock file is held
+var errLockBusy = errors.New("lease lock file busy")
+
+// update run fn on the lease of key under the lock file of key, it return
+// errLockBusy instead of waiting for a busy lock file if wait is false
+func (s *fileLeaseStore) update(ctx context.Context, key string, wait bool, fn func(Lease) (Lease, error)) (Lease, error) {
+	path := s.path(key)
+	lock := path + ".lock"
+	// without wait a stale lock file is broken once
+	broken := false
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return Lease{}, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLockFile && (wait || !broken) {
+			if broken = breakStale(lock); broken {
+				continue
+			}
+		}
+		if !wait {
+			return Lease{}, errLockBusy
+		}
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return Lease{}, ctx.Err()
+		}
+	}
+	defer os.Remove(lock)
+
+	var last Lease
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &last)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return Lease{}, err
+	}
+
+	lease, err := fn(last)
+	if err != nil {
+		return lease, err
+	}
+
+	if data, err = json.Marshal(lease); err != nil {
+		return lease, err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return lease, err
+	}
+	return lease, os.Rename(tmp, path)
+}
+
+// breakStale remove lock if it is still stale, the check and remove run
+// under a breaker lock file so a process which saw the same stale lock
+// cannot remove the fresh one created after it, return true if removed
+func breakStale(lock string) bool {
+	breaker := lock + ".break"
+	f, err := os.OpenFile(breaker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		// left by a process dead while breaking
+		if info, err := os.Stat(breaker); err == nil && time.Since(info.ModTime()) > staleLockFile {
+			os.Remove(breaker)
+		}
+		return false
+	}
+	f.Close()
+	defer os.Remove(breaker)
+
+	if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLockFile {
+		return os.Remove(lock) == nil
+	}
+	return false
+}
+
+func (s *fileLeaseStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (Lease, bool, error) {
+	return s.acquire(ctx, key, owner, ttl, true)
+}
+
+func (s *fileLeaseStore) TryAcquire(ctx context.Context, key, owner string, ttl time.Duration) (Lease, bool, error) {
+	lease, ok, err := s.acquire(ctx, key, owner, ttl, false)
+	if err == errLockBusy {
+		return lease, false, nil
+	}
+	return lease, ok, err
+}
+
+func (s *fileLeaseStore) acquire(ctx context.Context, key, owner string, ttl time.Duration, wait bool) (Lease, bool, error) {
+	var ok bool
+	lease, err := s.update(ctx, key, wait, func(last Lease) (Lease, error) {
+		var lease Lease
+		if lease, ok = grant(last, key, owner, ttl, s.now()); !ok {
+			return last, nil
+		}
+		return lease, nil
+	})
+	return lease, ok && err == nil, err
+}
+
+func (s *fileLeaseStore) Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	return s.update(ctx, lease.Key, true, func(last Lease) (Lease, error) {
+		now := s.now()
+		if !held(last, lease, now) {
+			return lease, ErrLeaseLost
+		}
+		lease.Expires = now.Add(ttl)
+		return lease, nil
+	})
+}
+
+func (s *fileLeaseStore) Release(ctx context.Context, lease Lease) error {
+	_, err := s.update(ctx, lease.Key, true, func(last Lease) (Lease, error) {
+		if last.Owner != lease.Owner || last.Token != lease.Token {
+			return lease, ErrLeaseLost
+		}
+		last.Owner = ""
+		last.Expires = time.Time{}
+		return last, nil
+	})
+	return err
+}
@@ -0,0 +1,197 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryLeaseStore(t *testing.T) {
+	store := NewMemoryLeaseStore()
+	now := time.Now()
+	store.(*memoryLeaseStore).now = func() time.Time { return now }
+	ctx := context.Background()
+
+	a, ok, _ := store.Acquire(ctx, "k", "a", time.Second)
+	if !ok || a.Token != 1 {
+		t.Fatalf("should acquire free key, got %+v", a)
+	}
+	if _, ok, _ = store.Acquire(ctx, "k", "b", time.Second); ok {
+		t.Errorf("cannot acquire leased key !!!")
+	}
+	if _, ok, _ = store.Acquire(ctx, "k", "a", time.Second); ok {
+		t.Errorf("cannot acquire leased key again by its owner !!!")
+	}
+
+	// expired lease can be taken by others with a greater token
+	now = now.Add(2 * time.Second)
+	b, ok, _ := store.Acquire(ctx, "k", "b", time.Second)
+	if !ok || b.Token != 2 {
+		t.Fatalf("should acquire expired key, got %+v", b)
+	}
+	if _, err := store.Renew(ctx, a, time.Second); err != ErrLeaseLost {
+		t.Errorf("stale lease should be lost, got %v", err)
+	}
+	if err := store.Release(ctx, b); err != nil {
+		t.Errorf("should release lease, got %v", err)
+	}
+	c, ok, _ := store.Acquire(ctx, "k", "a", time.Second)
+	if !ok || c.Token != 3 {
+		t.Errorf("token should keep increasing after release, got %+v", c)
+	}
+}
+
+func testLeaseMutexGroups(t *testing.T, store LeaseStore) {
+	opts := LeaseOptions{TTL: 60 * time.Millisecond}
+	// two groups act as two replicas
+	replicas := []MutexGroup{NewLeaseMutexGroup(store, opts), NewLeaseMutexGroup(store, opts)}
+
+	replicas[0].Lock("job")
+	if replicas[1].TryLock("job") {
+		t.Errorf("cannot fetch key held by other replica !!!")
+	}
+	lease, ok := replicas[0].(LeaseMutexGroup).Lease("job")
+	if !ok || lease.Token == 0 {
+		t.Errorf("should expose the lease of held key !!!")
+	}
+
+	// held longer than TTL, renewal keeps it
+	time.Sleep(100 * time.Millisecond)
+	if replicas[1].TryLockTimeout("job", 10*time.Millisecond) {
+		t.Errorf("renewed key cannot be fetched !!!")
+	}
+	replicas[0].UnLock("job")
+
+	// file store synchronize replicas out of sight of the race detector
+	var wg sync.WaitGroup
+	var holders, overlaps int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(mu MutexGroup) {
+			defer wg.Done()
+			mu.Lock("count")
+			if atomic.AddInt32(&holders, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			mu.UnLock("count")
+		}(replicas[i%2])
+	}
+	wg.Wait()
+	if overlaps != 0 {
+		t.Errorf("replicas held the key together %d times", overlaps)
+	}
+}
+
+func TestLeaseMutexGroupMemory(t *testing.T) {
+	testLeaseMutexGroups(t, NewMemoryLeaseStore())
+}
+
+func TestLeaseMutexGroupFile(t *testing.T) {
+	store, err := NewFileLeaseStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLeaseMutexGroups(t, store)
+}
+
+// ctxLeaseStore fail on a done context like a network store
+type ctxLeaseStore struct {
+	LeaseStore
+}
+
+func (s ctxLeaseStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (Lease, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Lease{}, false, err
+	}
+	return s.LeaseStore.Acquire(ctx, key, owner, ttl)
+}
+
+func TestLeaseMutexGroupTryLock(t *testing.T) {
+	mu := NewLeaseMutexGroup(ctxLeaseStore{NewMemoryLeaseStore()}, LeaseOptions{TTL: time.Second})
+	if !mu.TryLock("a") {
+		t.Errorf("should fetch free key !!!")
+	}
+	mu.UnLock("a")
+
+	PanicOnBug = false
+	defer func() { PanicOnBug = true }()
+	// 1 and "1" would share one lease
+	if mu.TryLock(1) || mu.TryLockTimeout(1, time.Millisecond) {
+		t.Errorf("key which is not a string should be rejected !!!")
+	}
+}
+
+func TestFileLeaseStoreStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileLeaseStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := store.(*fileLeaseStore).path("k") + ".lock"
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// busy lock file, TryLock must not wait for it
+	mu := NewLeaseMutexGroup(store, LeaseOptions{TTL: time.Second})
+	start := time.Now()
+	if mu.TryLock("k") {
+		t.Errorf("cannot fetch key with busy lock file !!!")
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("TryLock should not block on lock file, took %v", time.Since(start))
+	}
+
+	// processes racing on a stale lock file, only one get the lease
+	old := time.Now().Add(-2 * staleLockFile)
+	os.Chtimes(lock, old, old)
+	var wg sync.WaitGroup
+	var granted int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, _ := NewFileLeaseStore(dir)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, ok, _ := s.Acquire(ctx, "k", fmt.Sprint("owner-", i), time.Minute); ok {
+				atomic.AddInt32(&granted, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if granted != 1 {
+		t.Errorf("stale lock should be taken over once, granted %d", granted)
+	}
+}
+
+func TestLeaseMutexGroupOnLost(t *testing.T) {
+	store := NewMemoryLeaseStore()
+	lost := make(chan Lease, 1)
+	mu := NewLeaseMutexGroup(store, LeaseOptions{
+		TTL:    30 * time.Millisecond,
+		OnLost: func(l Lease, err error) { lost <- l },
+	})
+	mu.Lock("k")
+	lease, _ := mu.Lease("k")
+
+	// another owner steal the key
+	store.Release(context.Background(), lease)
+	store.Acquire(context.Background(), "k", "thief", time.Second)
+
+	select {
+	case l := <-lost:
+		if l.Key != "k" {
+			t.Errorf("should report lost key k, got %+v", l)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("lost lease should be reported !!!")
+	}
+	mu.UnLock("k")
+}
@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UnLockFunc release every key fetched by a LockAll call
+type UnLockFunc func()
+
+// orderKeys remove duplicated keys and sort them, so every caller
+// fetch the same keys in the same order and cannot deadlock each other
+func orderKeys(keys []interface{}) []interface{} {
+	ordered := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		dup := false
+		for _, k := range ordered {
+			if k == key {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			ordered = append(ordered, key)
+		}
+	}
+	sort.SliceStable(ordered, func(a, b int) bool {
+		return keyLess(ordered[a], ordered[b])
+	})
+	return ordered
+}
+
+func keyLess(a, b interface{}) bool {
+	return compareKeys(reflect.ValueOf(a), reflect.ValueOf(b)) < 0
+}
+
+// compareKeys is a total order of comparable keys, it panic on keys which
+// cannot be ordered since fetching them could deadlock
+func compareKeys(va, vb reflect.Value) int {
+	if !va.IsValid() || !vb.IsValid() {
+		return cmpBool(va.IsValid(), vb.IsValid())
+	}
+
+	if ta, tb := va.Type(), vb.Type(); ta != tb {
+		if c := strings.Compare(ta.String(), tb.String()); c != 0 {
+			return c
+		}
+		if c := strings.Compare(ta.PkgPath(), tb.PkgPath()); c != 0 {
+			return c
+		}
+		panic(fmt.Sprintf("cannot order keys of different types %v", ta))
+	}
+
+	switch va.Kind() {
+	case reflect.Bool:
+		return cmpBool(va.Bool(), vb.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(va.Int(), vb.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cmp.Compare(va.Uint(), vb.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(va.Float(), vb.Float())
+	case reflect.Complex64, reflect.Complex128:
+		ca, cb := va.Complex(), vb.Complex()
+		if c := cmp.Compare(real(ca), real(cb)); c != 0 {
+			return c
+		}
+		return cmp.Compare(imag(ca), imag(cb))
+	case reflect.String:
+		return strings.Compare(va.String(), vb.String())
+	case reflect.Ptr, reflect.UnsafePointer, reflect.Chan:
+		// distinct objects with equal contents are distinct keys
+		return cmp.Compare(va.Pointer(), vb.Pointer())
+	case reflect.Interface:
+		return compareKeys(va.Elem(), vb.Elem())
+	case reflect.Struct:
+		for i := 0; i < va.NumField(); i++ {
+			if c := compareKeys(va.Field(i), vb.Field(i)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Array:
+		for i := 0; i < va.Len(); i++ {
+			if c := compareKeys(va.Index(i), vb.Index(i)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	panic(fmt.Sprintf("cannot order keys of type %v", va.Type()))
+}
+
+func cmpBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	}
+	return 1
+}
+
+func unlockAll(g MutexGroup, keys []interface{}) UnLockFunc {
+	return func() {
+		// release in reverse order of fetching
+		for i := len(keys) - 1; i >= 0; i-- {
+			g.UnLock(keys[i])
+		}
+	}
+}
+
+func lockAll(g MutexGroup, keys []interface{}) UnLockFunc {
+	keys = orderKeys(keys)
+	for _, key := range keys {
+		g.Lock(key)
+	}
+	return unlockAll(g, keys)
+}
+
+// tryLockAll release fetched keys when try fail on any key
+func tryLockAll(g MutexGroup, keys []interface{}, try func(interface{}) bool) (UnLockFunc, bool) {
+	keys = orderKeys(keys)
+	for n, key := range keys {
+		if !try(key) {
+			unlockAll(g, keys[:n])()
+			return nil, false
+		}
+	}
+	return unlockAll(g, keys), true
+}
+
+func tryLockAllTimeout(g MutexGroup, keys []interface{}, timeout time.Duration) (UnLockFunc, bool) {
+	// the timeout is shared by all keys
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return tryLockAllContext(g, keys, ctx)
+}
+
+func tryLockAllContext(g MutexGroup, keys []interface{}, ctx context.Context) (UnLockFunc, bool) {
+	return tryLockAll(g, keys, func(key interface{}) bool {
+		return g.TryLockContext(key, ctx)
+	})
+}
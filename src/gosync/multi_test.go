@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMutexGroupLockAll(t *testing.T) {
+	groups := map[string]MutexGroup{
+		"group":   NewMutexGroup(),
+		"rw":      NewRWMutexGroup(),
+		"sharded": NewShardedMutexGroup(4),
+		"debug":   NewDebugMutexGroup(DebugOptions{}),
+	}
+	for name, mu := range groups {
+		t.Run(name, func(t *testing.T) {
+			accounts := map[string]int{"a": 100, "b": 100}
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				from, to := "a", "b"
+				if i%2 == 0 {
+					from, to = to, from
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					unlock := mu.LockAll(from, to)
+					accounts[from]--
+					accounts[to]++
+					unlock()
+				}()
+			}
+			wg.Wait()
+			if accounts["a"]+accounts["b"] != 200 {
+				t.Errorf("transfer lost money: %v", accounts)
+			}
+		})
+	}
+}
+
+func TestMutexGroupTryLockAll(t *testing.T) {
+	mu := NewMutexGroup()
+	mu.Lock("b")
+	if _, ok := mu.TryLockAll("a", "b", "c"); ok {
+		t.Errorf("cannot fetch locked key b !!!")
+	}
+	// a was fetched before b and must be released
+	if !mu.TryLock("a") {
+		t.Errorf("partial fetched key should be released !!!")
+	}
+	mu.UnLock("a")
+	mu.UnLock("b")
+
+	unlock, ok := mu.TryLockAll("a", "b", "a")
+	if !ok {
+		t.Fatalf("should fetch all keys !!!")
+	}
+	unlock()
+	if mu.(*mutexGroup).group.len() != 0 {
+		t.Errorf("all keys should be released !!!")
+	}
+}
+
+func TestMutexGroupTryLockAllContext(t *testing.T) {
+	mu := NewMutexGroup()
+	mu.Lock(2)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mu.UnLock(2)
+	}()
+	if _, ok := mu.TryLockAllTimeout(1*time.Millisecond, 1, 2); ok {
+		t.Errorf("cannot fetch keys in 1ms !!!")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	unlock, ok := mu.TryLockAllContext(ctx, 2, 1)
+	if !ok {
+		t.Fatalf("should fetch keys in 50ms !!!")
+	}
+	unlock()
+}
+
+func TestOrderKeys(t *testing.T) {
+	keys := orderKeys([]interface{}{"b", 10, "a", 2, "b", int64(1)})
+	expect := []interface{}{2, 10, int64(1), "a", "b"}
+	if len(keys) != len(expect) {
+		t.Fatalf("expect %v, got %v", expect, keys)
+	}
+	for i := range keys {
+		if keys[i] != expect[i] {
+			t.Errorf("expect %v, got %v", expect, keys)
+		}
+	}
+}
+
+type account struct {
+	Balance int
+}
+
+func TestOrderPointerKeys(t *testing.T) {
+	// equal contents must not make distinct accounts equal keys
+	a, b := &account{Balance: 100}, &account{Balance: 100}
+	ab := orderKeys([]interface{}{a, b})
+	ba := orderKeys([]interface{}{b, a})
+	if len(ab) != 2 || ab[0] != ba[0] {
+		t.Errorf("pointer keys should have the same order !!!")
+	}
+
+	mu := NewMutexGroup()
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func(keys ...interface{}) {
+			for n := 0; n < 1000; n++ {
+				mu.LockAll(keys...)()
+			}
+			done <- struct{}{}
+		}([]interface{}{a, b, b, a}[i*2 : i*2+2]...)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("LockAll deadlock on pointer keys !!!")
+		}
+	}
+}
+
+func TestOrderStructKeys(t *testing.T) {
+	keys := orderKeys([]interface{}{[2]int{1, 2}, account{2}, account{1}, [2]int{1, 1}, true, false})
+	expect := []interface{}{[2]int{1, 1}, [2]int{1, 2}, false, true, account{1}, account{2}}
+	for i := range keys {
+		if keys[i] != expect[i] {
+			t.Errorf("expect %v, got %v", expect, keys)
+		}
+	}
+}
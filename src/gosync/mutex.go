@@ -2,13 +2,24 @@ package sync
 
 import (
 	"context"
-	"sync"
 	"time"
 )
 
 // Set the behavier on unlock unlocked mutex
 var PanicOnBug = true
 
+func bug(msg string) {
+	if PanicOnBug {
+		panic(msg)
+	}
+}
+
+// unlocker is implemented by mutexes of this package, it report misuse
+// instead of handling it so groups can keep their bookkeeping right
+type unlocker interface {
+	unlock() bool
+}
+
 // another mutex implementation with TryLock method
 type Mutex interface {
 	Lock()
@@ -21,7 +32,16 @@ type Mutex interface {
 	TryLockContext(ctx context.Context) bool
 }
 
-func NewMutex() Mutex {
+// NewMutex give no ordering guarantee to waiters unless WithFIFO or
+// WithPriority is set
+func NewMutex(opts ...MutexOption) Mutex {
+	var o mutexOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.fifo || o.priority {
+		return &queueMutex{priority: o.priority}
+	}
 	return &mutex{ch: make(chan struct{}, 1)}
 }
 
@@ -34,13 +54,19 @@ func (m *mutex) Lock() {
 }
 
 func (m *mutex) UnLock() {
+	if !m.unlock() {
+		bug("unlock of unlocked mutex")
+	}
+}
+
+// unlock return false if the mutex is not locked
+func (m *mutex) unlock() bool {
 	select {
 	case <-m.ch:
+		return true
 	default:
-		if PanicOnBug {
-			panic("unlock of unlocked mutex")
-		}
 	}
+	return false
 }
 
 func (m *mutex) TryLock() bool {
@@ -73,6 +99,7 @@ func (m *mutex) TryLockContext(ctx context.Context) bool {
 type MutexGroup interface {
 	Lock(i interface{})
 	UnLock(i interface{})
+	// UnLockAndFree is the same as UnLock, idle keys are always freed
 	UnLockAndFree(i interface{})
 	// TryLock return true if it fetch mutex
 	TryLock(i interface{}) bool
@@ -80,58 +107,76 @@ type MutexGroup interface {
 	TryLockTimeout(i interface{}, timeout time.Duration) bool
 	// TryLockTimeout return true if it fetch mutex, return false if context done
 	TryLockContext(i interface{}, ctx context.Context) bool
-}
 
-func NewMutexGroup() MutexGroup {
-	return &mutexGroup{group: make(map[interface{}]Mutex)}
+	// LockAll lock every key in a deterministic order, so concurrent
+	// LockAll calls on overlapping keys never deadlock
+	LockAll(keys ...interface{}) UnLockFunc
+	// TryLockAll return false if any key is locked, fetched keys are released
+	TryLockAll(keys ...interface{}) (UnLockFunc, bool)
+	// TryLockAllTimeout return false if timeout, fetched keys are released
+	TryLockAllTimeout(timeout time.Duration, keys ...interface{}) (UnLockFunc, bool)
+	// TryLockAllContext return false if context done, fetched keys are released
+	TryLockAllContext(ctx context.Context, keys ...interface{}) (UnLockFunc, bool)
 }
 
-type mutexGroup struct {
-	mu    sync.Mutex
-	group map[interface{}]Mutex
+// NewMutexGroup create mutexes on demand and free a key once nobody
+// holds or waits on it, so it can be used on unbounded key spaces,
+// opts apply to the mutex of every key
+func NewMutexGroup(opts ...MutexOption) MutexGroup {
+	return &mutexGroup{group: newRefGroup(func() interface{} { return NewMutex(opts...) })}
 }
 
-func (m *mutexGroup) get(i interface{}) Mutex {
-	m.mu.Lock()
-	mu, ok := m.group[i]
-	if !ok {
-		mu = NewMutex()
-		m.group[i] = mu
-	}
-	m.mu.Unlock()
-	return mu
+type mutexGroup struct {
+	group *refGroup
 }
 
 func (m *mutexGroup) Lock(i interface{}) {
-	m.get(i).Lock()
+	m.group.acquire(i).(Mutex).Lock()
 }
 
 func (m *mutexGroup) UnLock(i interface{}) {
-	m.get(i).UnLock()
+	mu, ok := m.group.lookup(i)
+	if !ok || !mu.(unlocker).unlock() {
+		bug("unlock of unlocked mutex")
+		return
+	}
+	m.group.release(i)
 }
 
 func (m *mutexGroup) UnLockAndFree(i interface{}) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	mu, ok := m.group[i]
-	if !ok {
-		if PanicOnBug {
-			panic("unlock of unlocked mutex")
-		}
-		return
-	}
-	delete(m.group, i)
-	mu.UnLock()
+	m.UnLock(i)
 }
 
 func (m *mutexGroup) TryLock(i interface{}) bool {
-	return m.get(i).TryLock()
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(Mutex).TryLock()
+	})
 }
 
 func (m *mutexGroup) TryLockTimeout(i interface{}, timeout time.Duration) bool {
-	return m.get(i).TryLockTimeout(timeout)
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(Mutex).TryLockTimeout(timeout)
+	})
 }
 
 func (m *mutexGroup) TryLockContext(i interface{}, ctx context.Context) bool {
-	return m.get(i).TryLockContext(ctx)
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(Mutex).TryLockContext(ctx)
+	})
+}
+
+func (m *mutexGroup) LockAll(keys ...interface{}) UnLockFunc {
+	return lockAll(m, keys)
+}
+
+func (m *mutexGroup) TryLockAll(keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAll(m, keys, m.TryLock)
+}
+
+func (m *mutexGroup) TryLockAllTimeout(timeout time.Duration, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllTimeout(m, keys, timeout)
+}
+
+func (m *mutexGroup) TryLockAllContext(ctx context.Context, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllContext(m, keys, ctx)
 }
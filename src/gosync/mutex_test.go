@@ -3,6 +3,7 @@ package sync
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 )
@@ -103,6 +104,46 @@ func TestMutexGroupTryLockContext(t *testing.T) {
 	}
 }
 
+func TestMutexGroupFreeIdleKeys(t *testing.T) {
+	mu := NewMutexGroup()
+	group := mu.(*mutexGroup).group
+
+	mu.Lock("g")
+	if mu.TryLockTimeout("g", 1*time.Millisecond) {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	if group.len() != 1 {
+		t.Errorf("key should be kept while locked !!!")
+	}
+	mu.UnLock("g")
+	if group.len() != 0 {
+		t.Errorf("key should be freed after unlock !!!")
+	}
+
+	var wg sync.WaitGroup
+	counts := make([]int, 10)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := i % 10
+			mu.Lock(key)
+			counts[key]++
+			// the old free-while-waiting hazard: waiters must keep exclusion
+			mu.UnLockAndFree(key)
+		}(i)
+	}
+	wg.Wait()
+	for key, count := range counts {
+		if count != 10 {
+			t.Errorf("key %d locked %d times, expect 10 !!!", key, count)
+		}
+	}
+	if group.len() != 0 {
+		t.Errorf("all keys should be freed, got %d !!!", group.len())
+	}
+}
+
 func BenchmarkMutexGroup(b *testing.B) {
 	mu := NewMutexGroup()
 	a := 0
@@ -122,3 +163,81 @@ func BenchmarkMutexGroup(b *testing.B) {
 	_ = a
 	_ = c
 }
+
+func TestShardedMutexGroup(t *testing.T) {
+	mu := NewShardedMutexGroup(8)
+	mu.Lock("g")
+	if mu.TryLock("g") {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	if !mu.TryLock(1) {
+		t.Errorf("should fetch mutex of other key !!!")
+	}
+	mu.UnLock(1)
+	mu.UnLock("g")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mu.Lock("g")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if mu.TryLockContext("g", ctx) {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	mu.UnLock("g")
+
+	for _, shard := range mu.(*shardedMutexGroup).shards {
+		if shard.group.len() != 0 {
+			t.Errorf("all keys should be freed !!!")
+		}
+	}
+}
+
+func benchmarkMutexGroupDistinctKeys(b *testing.B, mu MutexGroup) {
+	var seq int64
+	var seqMu sync.Mutex
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		seqMu.Lock()
+		seq++
+		base := seq * 1000
+		seqMu.Unlock()
+		i := int64(0)
+		for pb.Next() {
+			key := base + i%1000
+			mu.Lock(key)
+			mu.UnLock(key)
+			i++
+		}
+	})
+}
+
+func BenchmarkMutexGroupDistinctKeys(b *testing.B) {
+	benchmarkMutexGroupDistinctKeys(b, NewMutexGroup())
+}
+
+func BenchmarkShardedMutexGroupDistinctKeys(b *testing.B) {
+	benchmarkMutexGroupDistinctKeys(b, NewShardedMutexGroup(64))
+}
+
+func BenchmarkShardedMutexGroup(b *testing.B) {
+	mu := NewShardedMutexGroup(64)
+	a := 0
+	c := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock("g")
+			a++
+			mu.UnLock("g")
+			mu.Lock("g")
+			c = a
+			mu.UnLock("g")
+		}
+	})
+	_ = a
+	_ = c
+}
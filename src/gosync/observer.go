@@ -0,0 +1,269 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Observer receive events of observed locks, key is the key of the lock
+// or its class when the group is observed with a class function
+type Observer interface {
+	// Acquired is called when the lock is fetched, contended is true if
+	// it was held by others when asked
+	Acquired(key interface{}, wait time.Duration, contended bool)
+	// Failed is called when TryLock fail, timeout or context done
+	Failed(key interface{}, wait time.Duration)
+	// Released is called on unlock with the holding duration
+	Released(key interface{}, hold time.Duration)
+}
+
+// ObserveMutex report events of mu to obs under key
+func ObserveMutex(mu Mutex, key interface{}, obs Observer) Mutex {
+	return &observedMutex{mu: mu, key: key, obs: obs}
+}
+
+type observedMutex struct {
+	mu  Mutex
+	key interface{}
+	obs Observer
+
+	// only accessed by the holder, zero when not held
+	acquired time.Time
+}
+
+func (m *observedMutex) lock(wait func() bool) bool {
+	start := time.Now()
+	if m.mu.TryLock() {
+		m.acquired = time.Now()
+		m.obs.Acquired(m.key, m.acquired.Sub(start), false)
+		return true
+	}
+	if wait == nil || !wait() {
+		m.obs.Failed(m.key, time.Since(start))
+		return false
+	}
+	m.acquired = time.Now()
+	m.obs.Acquired(m.key, m.acquired.Sub(start), true)
+	return true
+}
+
+func (m *observedMutex) Lock() {
+	m.lock(func() bool {
+		m.mu.Lock()
+		return true
+	})
+}
+
+func (m *observedMutex) UnLock() {
+	acquired := m.acquired
+	m.acquired = time.Time{}
+	m.mu.UnLock()
+	if !acquired.IsZero() {
+		m.obs.Released(m.key, time.Since(acquired))
+	}
+}
+
+func (m *observedMutex) TryLock() bool {
+	return m.lock(nil)
+}
+
+func (m *observedMutex) TryLockTimeout(timeout time.Duration) bool {
+	return m.lock(func() bool {
+		return m.mu.TryLockTimeout(timeout)
+	})
+}
+
+func (m *observedMutex) TryLockContext(ctx context.Context) bool {
+	return m.lock(func() bool {
+		return m.mu.TryLockContext(ctx)
+	})
+}
+
+// ObserveMutexGroup report events of g to obs, class map a key to the
+// key reported, nil class report the key itself
+func ObserveMutexGroup(g MutexGroup, obs Observer, class func(interface{}) interface{}) MutexGroup {
+	if class == nil {
+		class = func(i interface{}) interface{} { return i }
+	}
+	return &observedMutexGroup{
+		group:    g,
+		obs:      obs,
+		class:    class,
+		acquired: make(map[interface{}]time.Time),
+	}
+}
+
+type observedMutexGroup struct {
+	group MutexGroup
+	obs   Observer
+	class func(interface{}) interface{}
+
+	mu       sync.Mutex
+	acquired map[interface{}]time.Time
+}
+
+func (m *observedMutexGroup) lock(i interface{}, wait func() bool) bool {
+	start := time.Now()
+	contended := false
+	if !m.group.TryLock(i) {
+		if wait == nil || !wait() {
+			m.obs.Failed(m.class(i), time.Since(start))
+			return false
+		}
+		contended = true
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	m.acquired[i] = now
+	m.mu.Unlock()
+	m.obs.Acquired(m.class(i), now.Sub(start), contended)
+	return true
+}
+
+func (m *observedMutexGroup) Lock(i interface{}) {
+	m.lock(i, func() bool {
+		m.group.Lock(i)
+		return true
+	})
+}
+
+func (m *observedMutexGroup) UnLock(i interface{}) {
+	m.mu.Lock()
+	acquired, ok := m.acquired[i]
+	delete(m.acquired, i)
+	m.mu.Unlock()
+
+	m.group.UnLock(i)
+	if ok {
+		m.obs.Released(m.class(i), time.Since(acquired))
+	}
+}
+
+func (m *observedMutexGroup) UnLockAndFree(i interface{}) {
+	m.UnLock(i)
+}
+
+func (m *observedMutexGroup) TryLock(i interface{}) bool {
+	return m.lock(i, nil)
+}
+
+func (m *observedMutexGroup) TryLockTimeout(i interface{}, timeout time.Duration) bool {
+	return m.lock(i, func() bool {
+		return m.group.TryLockTimeout(i, timeout)
+	})
+}
+
+func (m *observedMutexGroup) TryLockContext(i interface{}, ctx context.Context) bool {
+	return m.lock(i, func() bool {
+		return m.group.TryLockContext(i, ctx)
+	})
+}
+
+func (m *observedMutexGroup) LockAll(keys ...interface{}) UnLockFunc {
+	return lockAll(m, keys)
+}
+
+func (m *observedMutexGroup) TryLockAll(keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAll(m, keys, m.TryLock)
+}
+
+func (m *observedMutexGroup) TryLockAllTimeout(timeout time.Duration, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllTimeout(m, keys, timeout)
+}
+
+func (m *observedMutexGroup) TryLockAllContext(ctx context.Context, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllContext(m, keys, ctx)
+}
+
+// LockStats accumulate the events of a key
+type LockStats struct {
+	Acquired  int64         `json:"acquired"`
+	Contended int64         `json:"contended"`
+	Failed    int64         `json:"failed"`
+	WaitTotal time.Duration `json:"wait_total_ns"`
+	WaitMax   time.Duration `json:"wait_max_ns"`
+	HoldTotal time.Duration `json:"hold_total_ns"`
+	HoldMax   time.Duration `json:"hold_max_ns"`
+}
+
+// ExpvarObserver keep LockStats per key in process, it implements
+// expvar.Var so it can be scraped with expvar.Publish(name, obs)
+type ExpvarObserver struct {
+	mu    sync.Mutex
+	stats map[string]*LockStats
+}
+
+func NewExpvarObserver() *ExpvarObserver {
+	return &ExpvarObserver{stats: make(map[string]*LockStats)}
+}
+
+// get must be called with o.mu held
+func (o *ExpvarObserver) get(key interface{}) *LockStats {
+	name := fmt.Sprint(key)
+	s, ok := o.stats[name]
+	if !ok {
+		s = new(LockStats)
+		o.stats[name] = s
+	}
+	return s
+}
+
+func (o *ExpvarObserver) Acquired(key interface{}, wait time.Duration, contended bool) {
+	o.mu.Lock()
+	s := o.get(key)
+	s.Acquired++
+	if contended {
+		s.Contended++
+	}
+	s.WaitTotal += wait
+	if wait > s.WaitMax {
+		s.WaitMax = wait
+	}
+	o.mu.Unlock()
+}
+
+func (o *ExpvarObserver) Failed(key interface{}, wait time.Duration) {
+	o.mu.Lock()
+	s := o.get(key)
+	s.Failed++
+	s.Contended++
+	s.WaitTotal += wait
+	if wait > s.WaitMax {
+		s.WaitMax = wait
+	}
+	o.mu.Unlock()
+}
+
+func (o *ExpvarObserver) Released(key interface{}, hold time.Duration) {
+	o.mu.Lock()
+	s := o.get(key)
+	s.HoldTotal += hold
+	if hold > s.HoldMax {
+		s.HoldMax = hold
+	}
+	o.mu.Unlock()
+}
+
+// Stats return a snapshot of stats by key
+func (o *ExpvarObserver) Stats() map[string]LockStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := make(map[string]LockStats, len(o.stats))
+	for k, s := range o.stats {
+		stats[k] = *s
+	}
+	return stats
+}
+
+// String return stats in JSON for expvar
+func (o *ExpvarObserver) String() string {
+	b, err := json.Marshal(o.Stats())
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserveMutex(t *testing.T) {
+	obs := NewExpvarObserver()
+	mu := ObserveMutex(NewMutex(), "m", obs)
+
+	mu.Lock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		mu.UnLock()
+	}()
+	if mu.TryLock() {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	if !mu.TryLockTimeout(time.Second) {
+		t.Errorf("should fetch mutex !!!")
+	}
+	mu.UnLock()
+
+	s := obs.Stats()["m"]
+	if s.Acquired != 2 || s.Failed != 1 || s.Contended != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s.WaitMax < 1*time.Millisecond || s.HoldMax < 1*time.Millisecond {
+		t.Errorf("wait and hold should be recorded, got %+v", s)
+	}
+}
+
+func TestObserveMutexUnLockUnlocked(t *testing.T) {
+	PanicOnBug = false
+	defer func() { PanicOnBug = true }()
+
+	obs := NewExpvarObserver()
+	mu := ObserveMutex(NewMutex(), "m", obs)
+	mu.Lock()
+	mu.UnLock()
+	time.Sleep(20 * time.Millisecond)
+	mu.UnLock()
+
+	if s := obs.Stats()["m"]; s.HoldMax >= 20*time.Millisecond {
+		t.Errorf("unlock of unlocked mutex should not be reported, got %+v", s)
+	}
+}
+
+func TestObserveMutexGroupClass(t *testing.T) {
+	obs := NewExpvarObserver()
+	mu := ObserveMutexGroup(NewMutexGroup(), obs, func(i interface{}) interface{} {
+		return strings.SplitN(i.(string), ":", 2)[0]
+	})
+
+	mu.Lock("user:1")
+	mu.Lock("user:2")
+	if mu.TryLockTimeout("user:1", 1*time.Millisecond) {
+		t.Errorf("cannot fetch mutex in 1ms !!!")
+	}
+	mu.UnLock("user:1")
+	mu.UnLock("user:2")
+	mu.Lock("order:1")
+	mu.UnLock("order:1")
+
+	stats := obs.Stats()
+	if s := stats["user"]; s.Acquired != 2 || s.Failed != 1 {
+		t.Errorf("unexpected user stats %+v", s)
+	}
+	if s := stats["order"]; s.Acquired != 1 || s.Contended != 0 {
+		t.Errorf("unexpected order stats %+v", s)
+	}
+
+	// obs is scraped by expvar through String
+	var _ expvar.Var = obs
+	var scraped map[string]LockStats
+	if err := json.Unmarshal([]byte(obs.String()), &scraped); err != nil {
+		t.Fatal(err)
+	}
+	if scraped["user"].Acquired != 2 {
+		t.Errorf("scraped stats should match, got %+v", scraped)
+	}
+}
@@ -0,0 +1,184 @@
+package sync
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+type mutexOptions struct {
+	fifo     bool
+	priority bool
+}
+
+type MutexOption func(*mutexOptions)
+
+// WithFIFO serve waiters of the mutex in arrival order
+func WithFIFO() MutexOption {
+	return func(o *mutexOptions) {
+		o.fifo = true
+	}
+}
+
+// WithPriority serve waiters of higher priority first and waiters of the
+// same priority in arrival order, the mutex implements PriorityMutex
+func WithPriority() MutexOption {
+	return func(o *mutexOptions) {
+		o.priority = true
+	}
+}
+
+// mutex serving waiters by priority, Lock use priority 0
+type PriorityMutex interface {
+	Mutex
+	LockPriority(p int)
+	// TryLockPriorityContext return true if it fetch mutex, return false if context done
+	TryLockPriorityContext(ctx context.Context, p int) bool
+}
+
+func NewPriorityMutex() PriorityMutex {
+	return &queueMutex{priority: true}
+}
+
+type queueMutex struct {
+	mu       sync.Mutex
+	locked   bool
+	priority bool
+	seq      uint64
+	waiters  waiterQueue
+}
+
+type queueWaiter struct {
+	priority int
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+func (m *queueMutex) lock(done <-chan struct{}, p int) bool {
+	m.mu.Lock()
+	if !m.locked && m.waiters.Len() == 0 {
+		m.locked = true
+		m.mu.Unlock()
+		return true
+	}
+
+	if !m.priority {
+		p = 0
+	}
+	m.seq++
+	w := &queueWaiter{priority: p, seq: m.seq, ready: make(chan struct{})}
+	heap.Push(&m.waiters, w)
+	m.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-done:
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-w.ready:
+		// handed over while leaving, pass it to the next waiter
+		m.handover()
+	default:
+		heap.Remove(&m.waiters, w.index)
+	}
+	return false
+}
+
+// handover give the mutex to the first waiter or unlock it, must hold m.mu
+func (m *queueMutex) handover() {
+	if m.waiters.Len() == 0 {
+		m.locked = false
+		return
+	}
+	w := heap.Pop(&m.waiters).(*queueWaiter)
+	close(w.ready)
+}
+
+func (m *queueMutex) Lock() {
+	m.lock(nil, 0)
+}
+
+func (m *queueMutex) LockPriority(p int) {
+	m.lock(nil, p)
+}
+
+func (m *queueMutex) UnLock() {
+	if !m.unlock() {
+		bug("unlock of unlocked mutex")
+	}
+}
+
+func (m *queueMutex) unlock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.locked {
+		return false
+	}
+	m.handover()
+	return true
+}
+
+func (m *queueMutex) TryLock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked || m.waiters.Len() > 0 {
+		return false
+	}
+	m.locked = true
+	return true
+}
+
+func (m *queueMutex) TryLockTimeout(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.lock(ctx.Done(), 0)
+}
+
+func (m *queueMutex) TryLockContext(ctx context.Context) bool {
+	return m.lock(ctx.Done(), 0)
+}
+
+func (m *queueMutex) TryLockPriorityContext(ctx context.Context, p int) bool {
+	return m.lock(ctx.Done(), p)
+}
+
+// waiterQueue is a heap of waiters by priority then arrival
+type waiterQueue []*queueWaiter
+
+func (q waiterQueue) Len() int {
+	return len(q)
+}
+
+func (q waiterQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiterQueue) Push(x interface{}) {
+	w := x.(*queueWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waiterQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return w
+}
@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockInOrder start waiters one by one and return the order they fetch mu
+func lockInOrder(mu Mutex, n int, lock func(i int)) []int {
+	var order []int
+	var orderMu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lock(i)
+			orderMu.Lock()
+			order = append(order, i)
+			orderMu.Unlock()
+			mu.UnLock()
+		}(i)
+		// let waiter i enqueue before i+1
+		time.Sleep(2 * time.Millisecond)
+	}
+	mu.UnLock()
+	wg.Wait()
+	return order
+}
+
+func TestMutexFIFO(t *testing.T) {
+	mu := NewMutex(WithFIFO())
+	mu.Lock()
+	order := lockInOrder(mu, 5, func(int) { mu.Lock() })
+	for i, o := range order {
+		if i != o {
+			t.Fatalf("waiters should be served in arrival order, got %v", order)
+		}
+	}
+}
+
+func TestPriorityMutex(t *testing.T) {
+	mu := NewPriorityMutex()
+	mu.Lock()
+	// waiter i ask priority i, the last one come first
+	order := lockInOrder(mu, 5, func(i int) { mu.LockPriority(i) })
+	for i, o := range order {
+		if o != 4-i {
+			t.Fatalf("waiters should be served by priority, got %v", order)
+		}
+	}
+
+	if _, ok := NewMutex(WithPriority()).(PriorityMutex); !ok {
+		t.Errorf("WithPriority should create a PriorityMutex !!!")
+	}
+}
+
+func TestMutexFIFOCancelledWaiterLeaves(t *testing.T) {
+	mu := NewMutex(WithFIFO())
+	mu.Lock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	if mu.TryLockContext(ctx) {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	if mu.TryLockTimeout(1 * time.Millisecond) {
+		t.Errorf("cannot fetch mutex in 1ms !!!")
+	}
+	mu.UnLock()
+
+	// no cancelled waiter left in queue to block it
+	if !mu.TryLock() {
+		t.Errorf("should fetch mutex !!!")
+	}
+	mu.UnLock()
+}
+
+func TestPriorityMutexCancelStress(t *testing.T) {
+	mu := NewPriorityMutex()
+	var wg sync.WaitGroup
+	count := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%3)*time.Microsecond)
+			defer cancel()
+			if mu.TryLockPriorityContext(ctx, i%4) {
+				count++
+				mu.UnLock()
+			}
+			mu.LockPriority(i % 4)
+			count++
+			mu.UnLock()
+		}(i)
+	}
+	wg.Wait()
+	if !mu.TryLock() {
+		t.Errorf("mutex should be free after all waiters !!!")
+	}
+}
+
+func TestMutexGroupFIFO(t *testing.T) {
+	mu := NewMutexGroup(WithFIFO())
+	mu.Lock("g")
+	if mu.TryLock("g") {
+		t.Errorf("cannot fetch mutex !!!")
+	}
+	mu.UnLock("g")
+	if mu.(*mutexGroup).group.len() != 0 {
+		t.Errorf("key should be freed !!!")
+	}
+}
+
+func BenchmarkMutexFIFO(b *testing.B) {
+	mu := NewMutex(WithFIFO())
+	a := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			a++
+			mu.UnLock()
+		}
+	})
+	_ = a
+}
@@ -0,0 +1,178 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrNotLocked = errors.New("unlock of unlocked mutex")
+	ErrNotOwner  = errors.New("unlock of mutex held by other owner")
+	ErrNoOwner   = errors.New("no owner of mutex in context")
+)
+
+// Owner identify the holder of a reentrant lock, zero is no owner
+type Owner uint64
+
+var lastOwner uint64
+
+func NewOwner() Owner {
+	return Owner(atomic.AddUint64(&lastOwner, 1))
+}
+
+type ownerKey struct{}
+
+// WithOwner return a context carrying owner for nested calls
+func WithOwner(ctx context.Context, owner Owner) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+func OwnerFromContext(ctx context.Context) (Owner, bool) {
+	owner, ok := ctx.Value(ownerKey{}).(Owner)
+	return owner, ok && owner != 0
+}
+
+// keyed lock which the owner can fetch again, it is released after the
+// owner unlock it as many times as it locked, misuse is returned as error
+type ReentrantMutexGroup interface {
+	// Lock fetch key for owner, a zero owner is replaced by a new one,
+	// the returned owner is used to re-enter and unlock
+	Lock(i interface{}, owner Owner) Owner
+	UnLock(i interface{}, owner Owner) error
+	// TryLock return true if it fetch mutex
+	TryLock(i interface{}, owner Owner) (Owner, bool)
+	// TryLockTimeout return true if it fetch mutex, return false if timeout
+	TryLockTimeout(i interface{}, owner Owner, timeout time.Duration) (Owner, bool)
+	// TryLockContext use the owner carried by ctx or a new one, return
+	// a context carrying the owner, return false if context done
+	TryLockContext(i interface{}, ctx context.Context) (context.Context, bool)
+	// UnLockContext unlock with the owner carried by ctx
+	UnLockContext(i interface{}, ctx context.Context) error
+}
+
+func NewReentrantMutexGroup() ReentrantMutexGroup {
+	return &reentrantMutexGroup{entries: make(map[interface{}]*reentrantEntry)}
+}
+
+type reentrantMutexGroup struct {
+	mu      sync.Mutex
+	entries map[interface{}]*reentrantEntry
+}
+
+type reentrantEntry struct {
+	owner   Owner
+	count   int
+	waiters int
+	// closed and replaced when the lock is released
+	notify chan struct{}
+}
+
+// free the entry of key if nobody holds or waits on it, must hold m.mu
+func (m *reentrantMutexGroup) free(i interface{}, e *reentrantEntry) {
+	if e.count == 0 && e.waiters == 0 {
+		delete(m.entries, i)
+	}
+}
+
+// lock wait for the key until done is closed, nil done wait forever
+func (m *reentrantMutexGroup) lock(i interface{}, owner Owner, done <-chan struct{}) (Owner, bool) {
+	if owner == 0 {
+		owner = NewOwner()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		e, ok := m.entries[i]
+		if !ok {
+			e = &reentrantEntry{notify: make(chan struct{})}
+			m.entries[i] = e
+		}
+		if e.count == 0 || e.owner == owner {
+			e.owner = owner
+			e.count++
+			return owner, true
+		}
+		if done == closedDone {
+			return owner, false
+		}
+
+		e.waiters++
+		notify := e.notify
+		m.mu.Unlock()
+		select {
+		case <-notify:
+		case <-done:
+			m.mu.Lock()
+			e.waiters--
+			m.free(i, e)
+			return owner, false
+		}
+		m.mu.Lock()
+		e.waiters--
+		m.free(i, e)
+	}
+}
+
+// closedDone make lock return at once if the key is held by others
+var closedDone = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
+func (m *reentrantMutexGroup) Lock(i interface{}, owner Owner) Owner {
+	owner, _ = m.lock(i, owner, nil)
+	return owner
+}
+
+func (m *reentrantMutexGroup) UnLock(i interface{}, owner Owner) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[i]
+	if !ok || e.count == 0 {
+		return ErrNotLocked
+	}
+	if e.owner != owner {
+		return ErrNotOwner
+	}
+	e.count--
+	if e.count == 0 {
+		e.owner = 0
+		close(e.notify)
+		e.notify = make(chan struct{})
+		m.free(i, e)
+	}
+	return nil
+}
+
+func (m *reentrantMutexGroup) TryLock(i interface{}, owner Owner) (Owner, bool) {
+	return m.lock(i, owner, closedDone)
+}
+
+func (m *reentrantMutexGroup) TryLockTimeout(i interface{}, owner Owner, timeout time.Duration) (Owner, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.lock(i, owner, ctx.Done())
+}
+
+func (m *reentrantMutexGroup) TryLockContext(i interface{}, ctx context.Context) (context.Context, bool) {
+	owner, ok := OwnerFromContext(ctx)
+	if !ok {
+		owner = NewOwner()
+		ctx = WithOwner(ctx, owner)
+	}
+	_, ok = m.lock(i, owner, ctx.Done())
+	return ctx, ok
+}
+
+func (m *reentrantMutexGroup) UnLockContext(i interface{}, ctx context.Context) error {
+	owner, ok := OwnerFromContext(ctx)
+	if !ok {
+		return ErrNoOwner
+	}
+	return m.UnLock(i, owner)
+}
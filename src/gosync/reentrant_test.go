@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReentrantMutexGroup(t *testing.T) {
+	mu := NewReentrantMutexGroup()
+	owner := mu.Lock("g", 0)
+	if owner == 0 {
+		t.Fatalf("should return a new owner !!!")
+	}
+	if mu.Lock("g", owner) != owner {
+		t.Errorf("owner should re-enter !!!")
+	}
+	if _, ok := mu.TryLock("g", NewOwner()); ok {
+		t.Errorf("other owner cannot fetch mutex !!!")
+	}
+
+	if err := mu.UnLock("g", NewOwner()); err != ErrNotOwner {
+		t.Errorf("expect ErrNotOwner, got %v", err)
+	}
+	if err := mu.UnLock("g", owner); err != nil {
+		t.Errorf("should unlock, got %v", err)
+	}
+	// still held once
+	if _, ok := mu.TryLockTimeout("g", NewOwner(), 1*time.Millisecond); ok {
+		t.Errorf("other owner cannot fetch mutex !!!")
+	}
+	if err := mu.UnLock("g", owner); err != nil {
+		t.Errorf("should unlock, got %v", err)
+	}
+	if err := mu.UnLock("g", owner); err != ErrNotLocked {
+		t.Errorf("expect ErrNotLocked, got %v", err)
+	}
+	if n := len(mu.(*reentrantMutexGroup).entries); n != 0 {
+		t.Errorf("key should be freed, got %d", n)
+	}
+}
+
+func TestReentrantMutexGroupWaiter(t *testing.T) {
+	mu := NewReentrantMutexGroup()
+	owner := mu.Lock("g", 0)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		mu.UnLock("g", owner)
+	}()
+	other, ok := mu.TryLockTimeout("g", 0, time.Second)
+	if !ok {
+		t.Fatalf("should fetch released mutex !!!")
+	}
+	mu.UnLock("g", other)
+}
+
+func TestReentrantMutexGroupContext(t *testing.T) {
+	mu := NewReentrantMutexGroup()
+
+	if err := mu.UnLockContext("g", context.Background()); err != ErrNoOwner {
+		t.Errorf("expect ErrNoOwner, got %v", err)
+	}
+
+	// nested calls share the owner carried by context
+	ctx, ok := mu.TryLockContext("g", context.Background())
+	if !ok {
+		t.Fatalf("should fetch mutex !!!")
+	}
+	if _, ok := mu.TryLockContext("g", ctx); !ok {
+		t.Errorf("nested call should re-enter !!!")
+	}
+
+	other, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
+	defer cancel()
+	if _, ok := mu.TryLockContext("g", other); ok {
+		t.Errorf("other request cannot fetch mutex !!!")
+	}
+
+	mu.UnLockContext("g", ctx)
+	mu.UnLockContext("g", ctx)
+	if n := len(mu.(*reentrantMutexGroup).entries); n != 0 {
+		t.Errorf("key should be freed, got %d", n)
+	}
+}
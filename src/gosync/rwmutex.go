@@ -0,0 +1,271 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// reader/writer mutex with TryLock methods
+// waiting writers block new readers, so writers are not starved
+type RWMutex interface {
+	Mutex
+	RLock()
+	RUnLock()
+	// TryRLock return true if it fetch read mutex
+	TryRLock() bool
+	// TryRLockTimeout return true if it fetch read mutex, return false if timeout
+	TryRLockTimeout(timeout time.Duration) bool
+	// TryRLockContext return true if it fetch read mutex, return false if context done
+	TryRLockContext(ctx context.Context) bool
+}
+
+func NewRWMutex() RWMutex {
+	return &rwmutex{notify: make(chan struct{})}
+}
+
+type rwmutex struct {
+	mu      sync.Mutex
+	readers int
+	writer  bool
+	// writers waiting for the mutex
+	waiting int
+	// closed and replaced on every state change to wake up waiters
+	notify chan struct{}
+}
+
+// broadcast must be called with m.mu held
+func (m *rwmutex) broadcast() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+// lock wait for the write mutex until done is closed, nil done wait forever
+func (m *rwmutex) lock(done <-chan struct{}) bool {
+	m.mu.Lock()
+	m.waiting++
+	for m.writer || m.readers > 0 {
+		notify := m.notify
+		m.mu.Unlock()
+		select {
+		case <-notify:
+		case <-done:
+			m.mu.Lock()
+			m.waiting--
+			// readers may wait only because of this writer
+			m.broadcast()
+			m.mu.Unlock()
+			return false
+		}
+		m.mu.Lock()
+	}
+	m.waiting--
+	m.writer = true
+	m.mu.Unlock()
+	return true
+}
+
+// rlock wait for the read mutex until done is closed, nil done wait forever
+func (m *rwmutex) rlock(done <-chan struct{}) bool {
+	m.mu.Lock()
+	for m.writer || m.waiting > 0 {
+		notify := m.notify
+		m.mu.Unlock()
+		select {
+		case <-notify:
+		case <-done:
+			return false
+		}
+		m.mu.Lock()
+	}
+	m.readers++
+	m.mu.Unlock()
+	return true
+}
+
+func (m *rwmutex) Lock() {
+	m.lock(nil)
+}
+
+func (m *rwmutex) UnLock() {
+	if !m.unlock() {
+		bug("unlock of unlocked mutex")
+	}
+}
+
+func (m *rwmutex) unlock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.writer {
+		return false
+	}
+	m.writer = false
+	m.broadcast()
+	return true
+}
+
+func (m *rwmutex) TryLock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.writer || m.readers > 0 {
+		return false
+	}
+	m.writer = true
+	return true
+}
+
+func (m *rwmutex) TryLockTimeout(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.lock(ctx.Done())
+}
+
+func (m *rwmutex) TryLockContext(ctx context.Context) bool {
+	return m.lock(ctx.Done())
+}
+
+func (m *rwmutex) RLock() {
+	m.rlock(nil)
+}
+
+func (m *rwmutex) RUnLock() {
+	if !m.runlock() {
+		bug("runlock of unlocked mutex")
+	}
+}
+
+func (m *rwmutex) runlock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.readers == 0 {
+		return false
+	}
+	m.readers--
+	if m.readers == 0 {
+		m.broadcast()
+	}
+	return true
+}
+
+func (m *rwmutex) TryRLock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.writer || m.waiting > 0 {
+		return false
+	}
+	m.readers++
+	return true
+}
+
+func (m *rwmutex) TryRLockTimeout(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.rlock(ctx.Done())
+}
+
+func (m *rwmutex) TryRLockContext(ctx context.Context) bool {
+	return m.rlock(ctx.Done())
+}
+
+type RWMutexGroup interface {
+	MutexGroup
+	RLock(i interface{})
+	RUnLock(i interface{})
+	// TryRLock return true if it fetch read mutex
+	TryRLock(i interface{}) bool
+	// TryRLockTimeout return true if it fetch read mutex, return false if timeout
+	TryRLockTimeout(i interface{}, timeout time.Duration) bool
+	// TryRLockContext return true if it fetch read mutex, return false if context done
+	TryRLockContext(i interface{}, ctx context.Context) bool
+}
+
+// NewRWMutexGroup free a key once nobody holds or waits on it like NewMutexGroup
+func NewRWMutexGroup() RWMutexGroup {
+	return &rwMutexGroup{group: newRefGroup(func() interface{} { return NewRWMutex() })}
+}
+
+type rwMutexGroup struct {
+	group *refGroup
+}
+
+func (m *rwMutexGroup) Lock(i interface{}) {
+	m.group.acquire(i).(RWMutex).Lock()
+}
+
+func (m *rwMutexGroup) UnLock(i interface{}) {
+	mu, ok := m.group.lookup(i)
+	if !ok || !mu.(unlocker).unlock() {
+		bug("unlock of unlocked mutex")
+		return
+	}
+	m.group.release(i)
+}
+
+func (m *rwMutexGroup) UnLockAndFree(i interface{}) {
+	m.UnLock(i)
+}
+
+func (m *rwMutexGroup) TryLock(i interface{}) bool {
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(RWMutex).TryLock()
+	})
+}
+
+func (m *rwMutexGroup) TryLockTimeout(i interface{}, timeout time.Duration) bool {
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(RWMutex).TryLockTimeout(timeout)
+	})
+}
+
+func (m *rwMutexGroup) TryLockContext(i interface{}, ctx context.Context) bool {
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(RWMutex).TryLockContext(ctx)
+	})
+}
+
+func (m *rwMutexGroup) LockAll(keys ...interface{}) UnLockFunc {
+	return lockAll(m, keys)
+}
+
+func (m *rwMutexGroup) TryLockAll(keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAll(m, keys, m.TryLock)
+}
+
+func (m *rwMutexGroup) TryLockAllTimeout(timeout time.Duration, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllTimeout(m, keys, timeout)
+}
+
+func (m *rwMutexGroup) TryLockAllContext(ctx context.Context, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllContext(m, keys, ctx)
+}
+
+func (m *rwMutexGroup) RLock(i interface{}) {
+	m.group.acquire(i).(RWMutex).RLock()
+}
+
+func (m *rwMutexGroup) RUnLock(i interface{}) {
+	mu, ok := m.group.lookup(i)
+	if !ok || !mu.(*rwmutex).runlock() {
+		bug("runlock of unlocked mutex")
+		return
+	}
+	m.group.release(i)
+}
+
+func (m *rwMutexGroup) TryRLock(i interface{}) bool {
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(RWMutex).TryRLock()
+	})
+}
+
+func (m *rwMutexGroup) TryRLockTimeout(i interface{}, timeout time.Duration) bool {
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(RWMutex).TryRLockTimeout(timeout)
+	})
+}
+
+func (m *rwMutexGroup) TryRLockContext(i interface{}, ctx context.Context) bool {
+	return m.group.try(i, func(mu interface{}) bool {
+		return mu.(RWMutex).TryRLockContext(ctx)
+	})
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRWMutex(t *testing.T) {
+	mu := NewRWMutex()
+	mu.RLock()
+	if !mu.TryRLock() {
+		t.Errorf("should fetch read mutex !!!")
+	}
+	if mu.TryLock() {
+		t.Errorf("cannot fetch mutex while reading !!!")
+	}
+	mu.RUnLock()
+	mu.RUnLock()
+
+	mu.Lock()
+	defer mu.UnLock()
+	if mu.TryRLock() {
+		t.Errorf("cannot fetch read mutex while writing !!!")
+	}
+}
+
+func TestRWMutexWriterPreference(t *testing.T) {
+	mu := NewRWMutex()
+	mu.RLock()
+
+	locked := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(locked)
+		time.Sleep(5 * time.Millisecond)
+		mu.UnLock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// writer is waiting, new readers must queue behind it
+	if mu.TryRLock() {
+		t.Errorf("cannot fetch read mutex while writer waiting !!!")
+	}
+	mu.RUnLock()
+	<-locked
+	if !mu.TryRLockTimeout(50 * time.Millisecond) {
+		t.Errorf("should fetch read mutex in 50ms !!!")
+	}
+	mu.RUnLock()
+}
+
+func TestRWMutexTryLockTimeout(t *testing.T) {
+	mu := NewRWMutex()
+	mu.RLock()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mu.RUnLock()
+	}()
+	if mu.TryLockTimeout(1 * time.Millisecond) {
+		t.Errorf("cannot fetch mutex in 1ms !!!")
+	}
+	if !mu.TryLockTimeout(50 * time.Millisecond) {
+		t.Errorf("should fetch mutex in 50ms !!!")
+	}
+	mu.UnLock()
+}
+
+func TestRWMutexTryRLockContext(t *testing.T) {
+	mu := NewRWMutex()
+	ctx, cancel := context.WithCancel(context.Background())
+	mu.Lock()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if mu.TryRLockContext(ctx) {
+		t.Errorf("cannot fetch read mutex !!!")
+	}
+}
+
+func TestRWMutexCancelledWriterReleasesReaders(t *testing.T) {
+	mu := NewRWMutex()
+	mu.RLock()
+	defer mu.RUnLock()
+	if mu.TryLockTimeout(1 * time.Millisecond) {
+		t.Errorf("cannot fetch mutex while reading !!!")
+	}
+	if !mu.TryRLock() {
+		t.Errorf("should fetch read mutex after writer gave up !!!")
+	}
+	mu.RUnLock()
+}
+
+func BenchmarkRWMutex(b *testing.B) {
+	mu := NewRWMutex()
+	a := 0
+	c := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			a++
+			mu.UnLock()
+			mu.RLock()
+			c = a
+			mu.RUnLock()
+		}
+	})
+	_ = a
+	_ = c
+}
+
+func TestRWMutexGroup(t *testing.T) {
+	mu := NewRWMutexGroup()
+	mu.RLock("g")
+	if !mu.TryRLock("g") {
+		t.Errorf("should fetch read mutex !!!")
+	}
+	if mu.TryLock("g") {
+		t.Errorf("cannot fetch mutex while reading !!!")
+	}
+	mu.RUnLock("g")
+	mu.RUnLock("g")
+	if !mu.TryLock("g") {
+		t.Errorf("should fetch mutex !!!")
+	}
+	mu.UnLock("g")
+}
+
+func TestRWMutexGroupTryRLockTimeout(t *testing.T) {
+	mu := NewRWMutexGroup()
+	mu.Lock("g")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mu.UnLock("g")
+	}()
+	if mu.TryRLockTimeout("g", 1*time.Millisecond) {
+		t.Errorf("cannot fetch read mutex in 1ms !!!")
+	}
+	if !mu.TryRLockTimeout("g", 50*time.Millisecond) {
+		t.Errorf("should fetch read mutex in 50ms !!!")
+	}
+	mu.RUnLock("g")
+}
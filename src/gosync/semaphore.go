@@ -0,0 +1,161 @@
+package sync
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// weighted semaphore, waiters are served in FIFO order so a large
+// request is not starved by small ones arriving later
+type Semaphore interface {
+	// Acquire n units, return ctx.Err() if context done before that
+	Acquire(ctx context.Context, n int64) error
+	// TryAcquire return true if it fetch n units without waiting
+	TryAcquire(n int64) bool
+	Release(n int64)
+}
+
+func NewSemaphore(size int64) Semaphore {
+	return &semaphore{size: size}
+}
+
+type semaphore struct {
+	mu      sync.Mutex
+	size    int64
+	cur     int64
+	waiters list.List
+}
+
+type semWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func (s *semaphore) Acquire(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	if n > s.size {
+		// never satisfied, wait for context only
+		s.mu.Unlock()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	w := &semWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// granted while cancelling, give it back
+			s.cur -= n
+			s.notify()
+		default:
+			front := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			// waiters behind a removed front may fit now
+			if front && s.size > s.cur {
+				s.notify()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+func (s *semaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= n
+	if s.cur < 0 {
+		s.cur = 0
+		bug("release of unacquired semaphore")
+	}
+	s.notify()
+}
+
+// notify wake up waiters in order while they fit, must hold s.mu
+func (s *semaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(*semWaiter)
+		if s.size-s.cur < w.n {
+			// keep the order, don't let smaller waiters pass
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// semaphores keyed like MutexGroup, idle keys are freed
+type SemaphoreGroup interface {
+	Acquire(i interface{}, ctx context.Context, n int64) error
+	TryAcquire(i interface{}, n int64) bool
+	Release(i interface{}, n int64)
+}
+
+// NewSemaphoreGroup create a semaphore of size for every key
+func NewSemaphoreGroup(size int64) SemaphoreGroup {
+	return &semaphoreGroup{group: newRefGroup(func() interface{} { return NewSemaphore(size) })}
+}
+
+type semaphoreGroup struct {
+	group *refGroup
+}
+
+func (m *semaphoreGroup) Acquire(i interface{}, ctx context.Context, n int64) error {
+	// keep one reference per acquired unit, so the key lives until all released
+	sem := m.group.acquire(i).(Semaphore)
+	if err := sem.Acquire(ctx, n); err != nil {
+		m.group.release(i)
+		return err
+	}
+	m.group.add(i, n-1)
+	return nil
+}
+
+func (m *semaphoreGroup) TryAcquire(i interface{}, n int64) bool {
+	sem := m.group.acquire(i).(Semaphore)
+	if !sem.TryAcquire(n) {
+		m.group.release(i)
+		return false
+	}
+	m.group.add(i, n-1)
+	return true
+}
+
+func (m *semaphoreGroup) Release(i interface{}, n int64) {
+	sem, ok := m.group.lookup(i)
+	if !ok {
+		bug("release of unacquired semaphore")
+		return
+	}
+	sem.(Semaphore).Release(n)
+	m.group.add(i, -n)
+}
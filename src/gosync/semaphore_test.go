@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	sem := NewSemaphore(10)
+	if !sem.TryAcquire(6) {
+		t.Errorf("should fetch 6 units !!!")
+	}
+	if sem.TryAcquire(5) {
+		t.Errorf("cannot fetch 5 units, only 4 left !!!")
+	}
+	if !sem.TryAcquire(4) {
+		t.Errorf("should fetch 4 units !!!")
+	}
+	sem.Release(10)
+	if !sem.TryAcquire(10) {
+		t.Errorf("should fetch all units after release !!!")
+	}
+	sem.Release(10)
+}
+
+func TestSemaphoreAcquireContext(t *testing.T) {
+	sem := NewSemaphore(2)
+	sem.Acquire(context.Background(), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("expect deadline exceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		sem.Release(1)
+	}()
+	if err := sem.Acquire(context.Background(), 1); err != nil {
+		t.Errorf("should fetch released unit, got %v", err)
+	}
+}
+
+func TestSemaphoreFIFO(t *testing.T) {
+	sem := NewSemaphore(4)
+	sem.Acquire(context.Background(), 3)
+
+	large := make(chan struct{})
+	go func() {
+		sem.Acquire(context.Background(), 4)
+		close(large)
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// a small request fits but must not pass the waiting large one
+	if sem.TryAcquire(1) {
+		t.Errorf("small request should queue behind large one !!!")
+	}
+	sem.Release(3)
+	select {
+	case <-large:
+	case <-time.After(time.Second):
+		t.Fatalf("large request should be served !!!")
+	}
+	sem.Release(4)
+}
+
+func TestSemaphoreCancelledFrontWakesOthers(t *testing.T) {
+	sem := NewSemaphore(4)
+	sem.Acquire(context.Background(), 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	small := make(chan error, 1)
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		small <- sem.Acquire(context.Background(), 1)
+	}()
+	if err := sem.Acquire(ctx, 4); err == nil {
+		t.Errorf("cannot fetch 4 units !!!")
+	}
+	select {
+	case err := <-small:
+		if err != nil {
+			t.Errorf("small request should be served, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("small request should be served after large one gave up !!!")
+	}
+}
+
+func TestSemaphoreGroup(t *testing.T) {
+	sem := NewSemaphoreGroup(3)
+	if err := sem.Acquire("a", context.Background(), 3); err != nil {
+		t.Errorf("should fetch 3 units, got %v", err)
+	}
+	if sem.TryAcquire("a", 1) {
+		t.Errorf("cannot fetch unit of full key !!!")
+	}
+	if !sem.TryAcquire("b", 2) {
+		t.Errorf("should fetch units of other key !!!")
+	}
+	sem.Release("a", 1)
+	sem.Release("a", 2)
+	sem.Release("b", 2)
+
+	if n := sem.(*semaphoreGroup).group.len(); n != 0 {
+		t.Errorf("all keys should be freed, got %d", n)
+	}
+}
@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"context"
+	"hash/maphash"
+	"time"
+)
+
+// NewShardedMutexGroup spread keys over shards by hash of the key, every
+// shard has its own map lock so goroutines locking distinct keys don't
+// contend on a single lock, shards <= 0 use 32 shards
+func NewShardedMutexGroup(shards int, opts ...MutexOption) MutexGroup {
+	if shards <= 0 {
+		shards = 32
+	}
+	m := &shardedMutexGroup{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*mutexGroup, shards),
+	}
+	for i := range m.shards {
+		m.shards[i] = NewMutexGroup(opts...).(*mutexGroup)
+	}
+	return m
+}
+
+type shardedMutexGroup struct {
+	seed   maphash.Seed
+	shards []*mutexGroup
+}
+
+func (m *shardedMutexGroup) shard(i interface{}) *mutexGroup {
+	h := maphash.Comparable(m.seed, i)
+	return m.shards[h%uint64(len(m.shards))]
+}
+
+func (m *shardedMutexGroup) Lock(i interface{}) {
+	m.shard(i).Lock(i)
+}
+
+func (m *shardedMutexGroup) UnLock(i interface{}) {
+	m.shard(i).UnLock(i)
+}
+
+func (m *shardedMutexGroup) UnLockAndFree(i interface{}) {
+	m.shard(i).UnLockAndFree(i)
+}
+
+func (m *shardedMutexGroup) TryLock(i interface{}) bool {
+	return m.shard(i).TryLock(i)
+}
+
+func (m *shardedMutexGroup) TryLockTimeout(i interface{}, timeout time.Duration) bool {
+	return m.shard(i).TryLockTimeout(i, timeout)
+}
+
+func (m *shardedMutexGroup) TryLockContext(i interface{}, ctx context.Context) bool {
+	return m.shard(i).TryLockContext(i, ctx)
+}
+
+func (m *shardedMutexGroup) LockAll(keys ...interface{}) UnLockFunc {
+	return lockAll(m, keys)
+}
+
+func (m *shardedMutexGroup) TryLockAll(keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAll(m, keys, m.TryLock)
+}
+
+func (m *shardedMutexGroup) TryLockAllTimeout(timeout time.Duration, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllTimeout(m, keys, timeout)
+}
+
+func (m *shardedMutexGroup) TryLockAllContext(ctx context.Context, keys ...interface{}) (UnLockFunc, bool) {
+	return tryLockAllContext(m, keys, ctx)
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Result of a call shared by SingleFlight
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
+// deduplicate concurrent calls keyed like MutexGroup, callers of the
+// same key share the result of the first call
+type SingleFlight interface {
+	// Do run fn once for concurrent callers of i, shared is true if the
+	// result was given to more than one caller
+	Do(i interface{}, fn func() (interface{}, error)) (v interface{}, err error, shared bool)
+	// DoChan is like Do but return a channel of the Result
+	DoChan(i interface{}, fn func() (interface{}, error)) <-chan Result
+	// DoContext return ctx.Err() if ctx is done before the call finish, the
+	// call keep running for other callers and its context is cancelled
+	// only when every caller has gone
+	DoContext(ctx context.Context, i interface{}, fn func(context.Context) (interface{}, error)) (v interface{}, err error, shared bool)
+	// Forget make the next call of i run fn instead of waiting the running one
+	Forget(i interface{})
+}
+
+func NewSingleFlight() SingleFlight {
+	return &singleFlight{calls: make(map[interface{}]*call)}
+}
+
+type singleFlight struct {
+	mu    sync.Mutex
+	calls map[interface{}]*call
+}
+
+type call struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+
+	// callers joined after the first one
+	dups int
+	// callers still waiting the result
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func (g *singleFlight) Do(i interface{}, fn func() (interface{}, error)) (interface{}, error, bool) {
+	return g.DoContext(context.Background(), i, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+func (g *singleFlight) DoChan(i interface{}, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	go func() {
+		v, err, shared := g.Do(i, fn)
+		ch <- Result{Val: v, Err: err, Shared: shared}
+	}()
+	return ch
+}
+
+func (g *singleFlight) DoContext(ctx context.Context, i interface{}, fn func(context.Context) (interface{}, error)) (interface{}, error, bool) {
+	c := g.join(i, fn)
+	select {
+	case <-c.done:
+		return c.val, c.err, c.dups > 0
+	case <-ctx.Done():
+		g.leave(i, c)
+		return nil, ctx.Err(), false
+	}
+}
+
+func (g *singleFlight) Forget(i interface{}) {
+	g.mu.Lock()
+	delete(g.calls, i)
+	g.mu.Unlock()
+}
+
+// join the running call of i or start a new one
+func (g *singleFlight) join(i interface{}, fn func(context.Context) (interface{}, error)) *call {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.calls[i]; ok {
+		c.dups++
+		c.waiters++
+		return c
+	}
+
+	// the call outlive the context of any single caller
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[i] = c
+	go g.run(ctx, i, c, fn)
+	return c
+}
+
+// leave cancel the call if no caller is waiting it anymore
+func (g *singleFlight) leave(i interface{}, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	c.cancel()
+	if g.calls[i] == c {
+		delete(g.calls, i)
+	}
+}
+
+func (g *singleFlight) run(ctx context.Context, i interface{}, c *call, fn func(context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("singleflight panic: %v", r)
+		}
+		g.mu.Lock()
+		if g.calls[i] == c {
+			delete(g.calls, i)
+		}
+		g.mu.Unlock()
+		close(c.done)
+		c.cancel()
+	}()
+	c.val, c.err = fn(ctx)
+}
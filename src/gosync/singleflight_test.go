@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlightDo(t *testing.T) {
+	g := NewSingleFlight()
+	v, err, shared := g.Do("k", func() (interface{}, error) {
+		return "v", nil
+	})
+	if v != "v" || err != nil || shared {
+		t.Errorf("unexpected result %v %v %v", v, err, shared)
+	}
+
+	_, err, _ = g.Do("k", func() (interface{}, error) {
+		return nil, errors.New("test")
+	})
+	if err == nil || err.Error() != "test" {
+		t.Errorf("error should be returned, got %v", err)
+	}
+}
+
+func TestSingleFlightShared(t *testing.T) {
+	g := NewSingleFlight()
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan Result, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- <-g.DoChan("k", fn)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if calls != 1 {
+		t.Errorf("fn should run once, got %d", calls)
+	}
+	for r := range results {
+		if r.Val != "v" || !r.Shared {
+			t.Errorf("result should be shared, got %+v", r)
+		}
+	}
+}
+
+func TestSingleFlightForget(t *testing.T) {
+	g := NewSingleFlight()
+	release := make(chan struct{})
+	first := g.DoChan("k", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	time.Sleep(5 * time.Millisecond)
+	g.Forget("k")
+
+	v, _, _ := g.Do("k", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 {
+		t.Errorf("forgotten key should run again, got %v", v)
+	}
+	close(release)
+	if r := <-first; r.Val != 1 {
+		t.Errorf("first call should get its own result, got %v", r.Val)
+	}
+}
+
+func TestSingleFlightDoContext(t *testing.T) {
+	g := NewSingleFlight()
+	cancelled := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "v", nil
+		case <-ctx.Done():
+			close(cancelled)
+			return nil, ctx.Err()
+		}
+	}
+
+	// the other caller keep the shared call alive
+	other := make(chan Result, 1)
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "k", fn)
+		other <- Result{Val: v, Err: err, Shared: shared}
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, "k", fn); err != context.DeadlineExceeded {
+		t.Errorf("expect deadline exceeded, got %v", err)
+	}
+	close(release)
+	if r := <-other; r.Val != "v" || r.Err != nil {
+		t.Errorf("shared call should not be cancelled, got %+v", r)
+	}
+
+	// the call is cancelled once every caller has gone
+	release = make(chan struct{})
+	cancelled = make(chan struct{})
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	g.DoContext(ctx, "k", fn)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("call without callers should be cancelled !!!")
+	}
+}
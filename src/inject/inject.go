@@ -1,15 +1,44 @@
 package inject
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 )
 
 const (
 	INJECT_MAX_RECURSIVE_LEVEL = 3
 )
 
-type typeError error
+type typeError struct {
+	error
+}
+
+// ResolveError is returned when resolution stop on an error, Path lead
+// from the struct field or provider which was resolved to the one failed
+type ResolveError struct {
+	Path []string
+	Err  error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("resolve <%s>: %v", strings.Join(e.Path, "> -> <"), e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// resolveError prepend step to path of err
+func resolveError(step string, err error) error {
+	if e, ok := err.(*ResolveError); ok {
+		e.Path = append([]string{step}, e.Path...)
+		return e
+	}
+	return &ResolveError{Path: []string{step}, Err: err}
+}
 
 type Injector interface {
 	TypeProvider
@@ -19,17 +48,43 @@ type Injector interface {
 	Apply(interface{}) error
 
 	SetParent(Injector) Injector
+	// NewScope create a child injector, scoped providers are rebuilt in it
+	// while singletons are shared with this injector
+	NewScope() Injector
+	// Close tear down instances built in this injector, providers may
+	// return a cleanup func or build Stopper or io.Closer instances
+	Close(ctx context.Context) error
+
+	// Validate check deps of all providers without invoking them
+	Validate() error
+	// Graph return the dependency graph of providers
+	Graph() *Graph
 
 	// private use
 	provInvoker
 }
 
 type Object struct {
-	Value interface{}
-	Type  interface{}
-	Name  string
+	Value    interface{}
+	Type     interface{}
+	Name     string
+	Lifetime Lifetime
 }
 
+// lifetime of instances built by function providers
+type Lifetime int
+
+const (
+	// Scoped instance is cached in the injector which resolve it
+	Scoped Lifetime = iota
+	// Singleton instance is built once with deps of the injector which
+	// register the provider and shared by all its scopes
+	Singleton
+	// Transient instance is built on every resolve, it is owned by the
+	// caller and not torn down by Close
+	Transient
+)
+
 type TypeProvider interface {
 	Provide(provs ...interface{}) TypeProvider
 	ProvideAs(prov interface{}, typ interface{}) TypeProvider
@@ -37,6 +92,7 @@ type TypeProvider interface {
 
 type provInvoker interface {
 	get(string) *providerInfo
+	visible() map[string]*providerInfo
 }
 
 type invokeStatus map[string]bool
@@ -50,15 +106,25 @@ func (m invokeStatus) set(name string) {
 	m[name] = false
 }
 
-type invokeCache map[string][]reflect.Value
+func (m invokeStatus) unset(name string) {
+	delete(m, name)
+}
+
+type invokeCache map[string]*instance
 
 type injector struct {
+	// guard values, caches and disposers
+	mu sync.RWMutex
+
 	// use for store provider
 	values map[string]*providerInfo
 
 	// user for cache provider instance for current inject
 	caches invokeCache
 
+	// teardown of instances built in this injector, in build order
+	disposers []disposer
+
 	parent Injector
 }
 
@@ -92,12 +158,15 @@ func (inj *injector) ProvideAs(prov interface{}, typ interface{}) TypeProvider {
 	}
 
 	info := newProvider(obj)
+	info.owner = inj
 
+	inj.mu.Lock()
 	// remove exists cache of provider
 	delete(inj.caches, info.name)
 
 	// replace with new prvoder info
 	inj.values[info.name] = info
+	inj.mu.Unlock()
 	return inj
 }
 
@@ -135,15 +204,14 @@ func (inj *injector) Find(ptr interface{}, name string) error {
 func (inj *injector) Invoke(prov interface{}) ([]reflect.Value, error) {
 	status := make(invokeStatus)
 
-	info := newProvider(Object{Value: prov})
+	// invoked func is never cached
+	info := newProvider(Object{Value: prov, Lifetime: Transient})
 	out, err := info.invoke(inj, status)
 
 	if err != nil {
-		return nil, fmt.Errorf("provider invoke err: %v", err)
+		return nil, fmt.Errorf("provider invoke err: %w", err)
 	}
 
-	// remove exists cache of provider
-	delete(inj.caches, info.name)
 	return out, nil
 }
 
@@ -163,7 +231,7 @@ func (inj *injector) apply(ptrStruct interface{}, status invokeStatus, level int
 	elm := reflect.Indirect(val)
 
 	if elm.Kind() != reflect.Struct {
-		return typeError(fmt.Errorf("expected a <*struct> of %v", val))
+		return typeError{fmt.Errorf("expected a <*struct> of %v", val)}
 	}
 
 	typ := elm.Type()
@@ -181,19 +249,22 @@ func (inj *injector) apply(ptrStruct interface{}, status invokeStatus, level int
 			continue
 		}
 
+		// struct field in resolution path
+		step := typ.String() + "." + structField.Name
+
 		if structField.Tag == "inject" || tagVal != "" {
 			// create name of inject value
 			provName := createName(indirectType(field.Type()), tagVal)
 
 			prov := inj.get(provName)
 			if prov == nil {
-				return fmt.Errorf("provider not found for type %s:%v", provName, field)
+				return resolveError(step, fmt.Errorf("provider not found for type %s:%v", provName, field))
 			}
 
 			out, err := prov.invoke(inj, status)
 
 			if err != nil {
-				return fmt.Errorf("provider invoke of type %s:%v err: %v", provName, field, err)
+				return resolveError(step, err)
 			}
 
 			if len(out) > 0 {
@@ -217,9 +288,13 @@ func (inj *injector) apply(ptrStruct interface{}, status invokeStatus, level int
 				field = field.Addr()
 			}
 
-			// child typeError should skip
-			if err, ok := inj.apply(field.Interface(), status, level).(typeError); !ok && err != nil {
-				return err
+			// child typeError should skip, fields which are not struct are
+			// not injected, other errors of nested structs like a missing
+			// provider fail the apply with the path of the field
+			if err := inj.apply(field.Interface(), status, level); err != nil {
+				if _, ok := err.(typeError); !ok {
+					return resolveError(step, err)
+				}
 			}
 		}
 	}
@@ -229,7 +304,10 @@ func (inj *injector) apply(ptrStruct interface{}, status invokeStatus, level int
 
 func (inj *injector) get(name string) *providerInfo {
 	// get provider in current injector
-	if prov := inj.values[name]; prov != nil {
+	inj.mu.RLock()
+	prov := inj.values[name]
+	inj.mu.RUnlock()
+	if prov != nil {
 		return prov
 	}
 
@@ -247,6 +325,28 @@ func (inj *injector) SetParent(parent Injector) Injector {
 	return inj
 }
 
+func (inj *injector) NewScope() Injector {
+	return New().SetParent(inj)
+}
+
+// cache return instance of scoped provider in this injector
+func (inj *injector) cache(name string) *instance {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	ins := inj.caches[name]
+	if ins == nil {
+		ins = new(instance)
+		inj.caches[name] = ins
+	}
+	return ins
+}
+
+func (inj *injector) dispose(d disposer) {
+	inj.mu.Lock()
+	inj.disposers = append(inj.disposers, d)
+	inj.mu.Unlock()
+}
+
 func assignValue(out, elm reflect.Value) (err error) {
 	if out.Type().AssignableTo(elm.Type()) {
 		elm.Set(out)
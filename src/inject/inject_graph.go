@@ -0,0 +1,220 @@
+package inject
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+func (l Lifetime) String() string {
+	switch l {
+	case Scoped:
+		return "scoped"
+	case Singleton:
+		return "singleton"
+	case Transient:
+		return "transient"
+	}
+	return fmt.Sprintf("Lifetime(%d)", int(l))
+}
+
+// MissingError report a dep which has no provider
+type MissingError struct {
+	Provider string
+	Dep      string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("provider not found of dep <%s> by <%s>", e.Dep, e.Provider)
+}
+
+// CycleError report providers which depend on each other, the first
+// provider of Path is also its last one
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("provider cycle dependencies <%s>", strings.Join(e.Path, "> -> <"))
+}
+
+// ValidateErrors is returned by Validate with every missing dep and cycle
+type ValidateErrors []error
+
+func (e ValidateErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d invalid dependencies: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e ValidateErrors) Unwrap() []error {
+	return e
+}
+
+// visible return providers can be found from this injector
+func (inj *injector) visible() map[string]*providerInfo {
+	provs := make(map[string]*providerInfo)
+	if inj.parent != nil {
+		provs = inj.parent.visible()
+	}
+	inj.mu.RLock()
+	for name, prov := range inj.values {
+		provs[name] = prov
+	}
+	inj.mu.RUnlock()
+	return provs
+}
+
+// resolver return the injector which resolve deps of p
+func (inj *injector) resolver(p *providerInfo) *injector {
+	if p.lifetime == Singleton && p.owner != nil {
+		return p.owner
+	}
+	return inj
+}
+
+func sortedNames(provs map[string]*providerInfo) []string {
+	names := make([]string, 0, len(provs))
+	for name := range provs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate check deps of all providers without invoking them, return
+// ValidateErrors with every missing dep and cycle
+func (inj *injector) Validate() error {
+	var errs ValidateErrors
+
+	provs := inj.visible()
+	names := sortedNames(provs)
+
+	// 0: not visited, 1: on path, 2: done
+	state := make(map[*providerInfo]int)
+	var path []string
+
+	var visit func(p *providerInfo)
+	visit = func(p *providerInfo) {
+		state[p] = 1
+		path = append(path, p.name)
+
+		res := inj.resolver(p)
+		for _, dep := range p.deps {
+			prov := res.get(dep)
+			if prov == nil {
+				errs = append(errs, &MissingError{Provider: p.name, Dep: dep})
+				continue
+			}
+
+			switch state[prov] {
+			case 0:
+				visit(prov)
+			case 1:
+				for i := range path {
+					if path[i] == prov.name {
+						cycle := append(append([]string{}, path[i:]...), prov.name)
+						errs = append(errs, &CycleError{Path: cycle})
+						break
+					}
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[p] = 2
+	}
+
+	for _, name := range names {
+		if p := provs[name]; state[p] == 0 {
+			visit(p)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// GraphNode is a provider in dependency graph
+type GraphNode struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Value    bool     `json:"value,omitempty"`
+	Lifetime string   `json:"lifetime,omitempty"`
+	Deps     []string `json:"deps,omitempty"`
+}
+
+// Graph is the dependency graph of providers found from an injector
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+}
+
+func (inj *injector) Graph() *Graph {
+	g := new(Graph)
+
+	provs := inj.visible()
+	for _, name := range sortedNames(provs) {
+		p := provs[name]
+		node := GraphNode{
+			Name: name,
+			Type: p.typ.String(),
+			Deps: append([]string(nil), p.deps...),
+		}
+		if p.value != nil {
+			node.Value = true
+		} else {
+			node.Lifetime = p.lifetime.String()
+		}
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	return g
+}
+
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT write graph in graphviz format, missing deps are dashed
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+
+	nodes := make(map[string]bool, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes[node.Name] = true
+	}
+
+	b.WriteString("digraph inject {\n")
+	for _, node := range g.Nodes {
+		label := node.Type
+		if node.Value {
+			label += "\nvalue"
+		} else {
+			label += "\n" + node.Lifetime
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q];\n", node.Name, label)
+	}
+
+	missing := make(map[string]bool)
+	for _, node := range g.Nodes {
+		for _, dep := range node.Deps {
+			if !nodes[dep] && !missing[dep] {
+				missing[dep] = true
+				fmt.Fprintf(&b, "\t%q [style=dashed];\n", dep)
+			}
+			fmt.Fprintf(&b, "\t%q -> %q;\n", node.Name, dep)
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
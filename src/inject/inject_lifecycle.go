@@ -0,0 +1,110 @@
+package inject
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// Starter is started right after built by its provider
+type Starter interface {
+	Start() error
+}
+
+// Stopper is stopped by Close of the injector which own it
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// teardown of a built instance
+type disposer func(ctx context.Context) error
+
+var (
+	cleanupType    = reflect.TypeOf(func() {})
+	cleanupErrType = reflect.TypeOf(func() error { return nil })
+)
+
+// isCleanup report whether typ is a cleanup func returned by provider
+// as `func() (T, func())` or `func() (T, func() error)`
+func isCleanup(typ reflect.Type) bool {
+	return typ == cleanupType || typ == cleanupErrType
+}
+
+// start instance and return its disposer, cleanup func returned by
+// provider take priority over Stopper and io.Closer of instance
+func (p *providerInfo) start(out []reflect.Value) (d disposer, err error) {
+	if len(out) == 0 {
+		return
+	}
+
+	if ins := instanceOf(out[0]); ins != nil {
+		if s, ok := ins.(Starter); ok {
+			if err = s.Start(); err != nil {
+				return
+			}
+		}
+
+		switch c := ins.(type) {
+		case Stopper:
+			d = c.Stop
+		case io.Closer:
+			d = func(context.Context) error { return c.Close() }
+		}
+	}
+
+	if p.cleanup >= 0 && !out[p.cleanup].IsNil() {
+		switch c := out[p.cleanup].Interface().(type) {
+		case func():
+			d = func(context.Context) error { c(); return nil }
+		case func() error:
+			d = func(context.Context) error { return c() }
+		}
+	}
+	return
+}
+
+// Close tear down instances built in this injector in reverse order, so
+// an instance is always closed before its dependencies
+func (inj *injector) Close(ctx context.Context) error {
+	var errs []error
+
+	inj.mu.Lock()
+	disposers := inj.disposers
+	inj.disposers = nil
+	inj.caches = make(invokeCache)
+	provs := make([]*providerInfo, 0, len(inj.values))
+	for _, prov := range inj.values {
+		provs = append(provs, prov)
+	}
+	inj.mu.Unlock()
+
+	for _, prov := range provs {
+		prov.instance.reset()
+	}
+
+	for i := len(disposers) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := disposers[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func instanceOf(val reflect.Value) interface{} {
+	if !val.IsValid() {
+		return nil
+	}
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if val.IsNil() {
+			return nil
+		}
+	}
+	return val.Interface()
+}
@@ -3,6 +3,7 @@ package inject
 import (
 	"fmt"
 	"reflect"
+	"sync"
 )
 
 type Provider interface{}
@@ -10,6 +11,26 @@ type Provide []Provider
 
 type Dep map[int]string
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// instance built by provider, mu make sure it is built only once
+type instance struct {
+	mu  sync.Mutex
+	out []reflect.Value
+}
+
+func (ins *instance) get() []reflect.Value {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	return ins.out
+}
+
+func (ins *instance) reset() {
+	ins.mu.Lock()
+	ins.out = nil
+	ins.mu.Unlock()
+}
+
 type providerInfo struct {
 	name string
 
@@ -32,7 +53,19 @@ type providerInfo struct {
 	// reflect value of provider value
 	val reflect.Value
 
-	done bool
+	lifetime Lifetime
+
+	// injector which register the provider
+	owner *injector
+
+	// instance of singleton provider
+	instance instance
+
+	// index of cleanup func in outputs of provider, -1 if none
+	cleanup int
+
+	// index of error in outputs of provider, -1 if none
+	errIdx int
 }
 
 func newProvider(obj Object) (info *providerInfo) {
@@ -49,7 +82,7 @@ func newProvider(obj Object) (info *providerInfo) {
 	}
 
 	var depMap Dep
-	info = &providerInfo{}
+	info = &providerInfo{lifetime: obj.Lifetime, cleanup: -1, errIdx: -1}
 
 	if len(provs) > 0 {
 		info.prov = provs[len(provs)-1]
@@ -80,6 +113,16 @@ func newProvider(obj Object) (info *providerInfo) {
 		info.setName(obj.Name)
 	}
 
+	if n := info.ptyp.NumOut(); n > 1 {
+		if isCleanup(info.ptyp.Out(1)) {
+			info.cleanup = 1
+		}
+		// provider as `func() (T, error)`
+		if info.ptyp.Out(n-1) == errorType {
+			info.errIdx = n - 1
+		}
+	}
+
 	numIn := info.ptyp.NumIn()
 	deps := make([]string, 0, numIn)
 
@@ -95,7 +138,9 @@ func newProvider(obj Object) (info *providerInfo) {
 
 func newProviderValue(obj Object, val reflect.Value) *providerInfo {
 	info := &providerInfo{
-		value: obj.Value,
+		value:   obj.Value,
+		cleanup: -1,
+		errIdx:  -1,
 	}
 
 	if val.Kind() != reflect.Ptr {
@@ -123,26 +168,51 @@ func (p *providerInfo) setName(name string) {
 	p.name = createName(p.typ, name)
 }
 
+// label of provider in resolution path
+func (p *providerInfo) label() string {
+	if p.name != "" {
+		return p.name
+	}
+	return p.ptyp.String()
+}
+
 func (p *providerInfo) invoke(inj *injector, status invokeStatus) (out []reflect.Value, err error) {
-	if v, ok := inj.caches[p.name]; ok {
-		out = v
+	if p.value != nil {
+		out = []reflect.Value{p.val}
 		return
 	}
 
-	defer func() {
-		if err == nil {
-			p.done = true
+	var ins *instance
+	switch p.lifetime {
+	case Singleton:
+		// deps of singleton come from the injector which own it
+		if p.owner != nil {
+			inj = p.owner
 		}
-	}()
+		ins = &p.instance
+	case Scoped:
+		ins = inj.cache(p.name)
+	}
+
+	if ins != nil {
+		if out = ins.get(); out != nil {
+			return
+		}
+	}
 
 	// on process
 	status.set(p.name)
+	defer status.unset(p.name)
 
-	if p.value != nil {
-		out = []reflect.Value{p.val}
-		return
-	}
+	defer func() {
+		if err != nil {
+			out = nil
+			err = resolveError(p.label(), err)
+		}
+	}()
 
+	// deps are resolved without lock of instance, so concurrent flows of
+	// cycle dependencies get an error instead of deadlock
 	in := make([]reflect.Value, 0, len(p.deps))
 	for _, dep := range p.deps {
 		prov := inj.get(dep)
@@ -152,7 +222,7 @@ func (p *providerInfo) invoke(inj *injector, status invokeStatus) (out []reflect
 		}
 
 		// avoid cycle dependencies
-		if !prov.done && status.has(prov.name) {
+		if status.has(prov.name) {
 			err = fmt.Errorf("provider cycle dependencies of dep <%s> by %v", dep, p.ptyp)
 			return
 		}
@@ -174,10 +244,39 @@ func (p *providerInfo) invoke(inj *injector, status invokeStatus) (out []reflect
 		in = append(in, ot[0])
 	}
 
+	if ins != nil {
+		ins.mu.Lock()
+		defer ins.mu.Unlock()
+		// built by another flow while resolving deps
+		if ins.out != nil {
+			out = ins.out
+			return
+		}
+	}
+
 	// invoke provider function
 	out = p.pval.Call(in)
+	if p.errIdx >= 0 && !out[p.errIdx].IsNil() {
+		err = out[p.errIdx].Interface().(error)
+		return
+	}
+
 	if p.ptyp.NumOut() > 0 {
-		inj.caches[p.name] = out
+		// only instances of registered providers are owned by injector
+		if p.owner != nil {
+			d, er := p.start(out)
+			if er != nil {
+				err = er
+				return
+			}
+			if d != nil && p.lifetime != Transient {
+				inj.dispose(d)
+			}
+		}
+
+		if ins != nil {
+			ins.out = out
+		}
 	}
 	return
 }
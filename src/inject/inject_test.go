@@ -1,12 +1,19 @@
 package inject
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type Logger interface {
@@ -242,6 +249,380 @@ func Test_CycleDependencies(t *testing.T) {
 	assert.True(strings.Index(err.Error(), "cycle dependencies") != -1)
 }
 
+func Test_Lifetime(t *testing.T) {
+	assert := &Assert{T: t}
+
+	count := 0
+	newSingle := func() *Single {
+		count++
+		return &Single{Count: count}
+	}
+
+	inj := New()
+	inj.Provide(Object{Value: newSingle, Lifetime: Singleton})
+	for i := 0; i < 3; i++ {
+		var single *Single
+		assert.NoError(inj.NewScope().Find(&single, ""))
+		assert.True(single.Count == 1)
+	}
+
+	count = 0
+	inj = New()
+	inj.Provide(Object{Value: newSingle, Lifetime: Transient})
+	var s1, s2 *Single
+	assert.NoError(inj.Find(&s1, ""))
+	assert.NoError(inj.Find(&s2, ""))
+	assert.True(s1 != s2)
+	assert.True(count == 2)
+}
+
+func Test_Scope(t *testing.T) {
+	assert := &Assert{T: t}
+
+	inj := New()
+	inj.Provide(func(req *http.Request) *Log {
+		return &Log{req: req}
+	})
+	inj.Provide(Object{Value: func() *Single { return new(Single) }, Lifetime: Singleton})
+
+	var singles []*Single
+	for _, method := range []string{"GET", "POST"} {
+		req, _ := http.NewRequest(method, "http://localhost/", nil)
+		scope := inj.NewScope()
+		scope.Provide(req)
+
+		var log, again *Log
+		assert.NoError(scope.Find(&log, ""))
+		assert.NoError(scope.Find(&again, ""))
+		assert.True(log == again)
+		assert.True(log.req == req)
+
+		var single *Single
+		assert.NoError(scope.Find(&single, ""))
+		singles = append(singles, single)
+	}
+	assert.True(singles[0] == singles[1])
+
+	// singleton cannot capture values of a scope
+	inj.Provide(Object{Value: func(req *http.Request) *Service { return new(Service) }, Lifetime: Singleton})
+	scope := inj.NewScope()
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	scope.Provide(req)
+	var service *Service
+	assert.Error(scope.Find(&service, ""))
+}
+
+type DB struct {
+	closed *[]string
+}
+
+func (db *DB) Close() error {
+	*db.closed = append(*db.closed, "db")
+	return errors.New("db close")
+}
+
+type Conn struct {
+	started bool
+	closed  *[]string
+}
+
+func (c *Conn) Start() error {
+	c.started = true
+	return nil
+}
+
+func (c *Conn) Stop(ctx context.Context) error {
+	*c.closed = append(*c.closed, "conn")
+	return nil
+}
+
+func Test_Close(t *testing.T) {
+	assert := &Assert{T: t}
+
+	var closed []string
+	inj := New()
+	inj.Provide(func() *DB {
+		return &DB{closed: &closed}
+	})
+	inj.Provide(func(db *DB) *Conn {
+		return &Conn{closed: &closed}
+	})
+	inj.Provide(func(c *Conn) (*Log, func()) {
+		return new(Log), func() { closed = append(closed, "log") }
+	})
+
+	var log *Log
+	assert.NoError(inj.Find(&log, ""))
+	var conn *Conn
+	assert.NoError(inj.Find(&conn, ""))
+	assert.True(conn.started)
+
+	err := inj.Close(context.Background())
+	assert.Error(err)
+	assert.True(strings.Contains(err.Error(), "db close"))
+	assert.True(strings.Join(closed, ",") == "log,conn,db")
+
+	// closed instances are rebuilt
+	var again *Conn
+	assert.NoError(inj.Find(&again, ""))
+	assert.True(again != conn)
+}
+
+func Test_CloseTransient(t *testing.T) {
+	assert := &Assert{T: t}
+
+	var closed []string
+	inj := New()
+	inj.Provide(Object{Value: func() *DB { return &DB{closed: &closed} }, Lifetime: Transient})
+	for i := 0; i < 100; i++ {
+		var db *DB
+		assert.NoError(inj.Find(&db, ""))
+		db.Close()
+	}
+	closed = nil
+
+	// transient instances are owned by the caller
+	assert.NoError(inj.Close(context.Background()))
+	assert.True(len(closed) == 0)
+}
+
+func Test_CloseScope(t *testing.T) {
+	assert := &Assert{T: t}
+
+	var closed []string
+	inj := New()
+	inj.Provide(Object{Value: func() *DB { return &DB{closed: &closed} }, Lifetime: Singleton})
+	inj.Provide(func(db *DB) *Conn { return &Conn{closed: &closed} })
+
+	scope := inj.NewScope()
+	var conn *Conn
+	assert.NoError(scope.Find(&conn, ""))
+	assert.NoError(scope.Close(context.Background()))
+	assert.True(strings.Join(closed, ",") == "conn")
+
+	assert.Error(inj.Close(context.Background()))
+	assert.True(strings.Join(closed, ",") == "conn,db")
+}
+
+func Test_Validate(t *testing.T) {
+	assert := &Assert{T: t}
+
+	assert.NoError(CreateProvide().Validate())
+
+	inj := New()
+	inj.Provide(func(log Logger) *Service {
+		return new(Service)
+	})
+	inj.Provide(func(s *Service) Logger {
+		return new(Log)
+	})
+	inj.Provide(func(req *http.Request, db *DB) *Log {
+		return new(Log)
+	})
+
+	err := inj.Validate()
+	assert.Error(err)
+	errs, ok := err.(ValidateErrors)
+	assert.True(ok)
+	assert.True(len(errs) == 3)
+
+	var missing, cycles int
+	for _, err := range errs {
+		switch e := err.(type) {
+		case *MissingError:
+			missing++
+		case *CycleError:
+			cycles++
+			assert.True(len(e.Path) == 3 && e.Path[0] == e.Path[2])
+		}
+	}
+	assert.True(missing == 2)
+	assert.True(cycles == 1)
+
+	// deps can be provided by scope
+	scope := inj.NewScope()
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	scope.Provide(req, &DB{})
+	var cycle *CycleError
+	assert.True(errors.As(scope.Validate(), &cycle))
+}
+
+func Test_Graph(t *testing.T) {
+	assert := &Assert{T: t}
+
+	inj := New()
+	inj.Provide(Object{Value: func() *DB { return new(DB) }, Lifetime: Singleton})
+	inj.Provide(func(db *DB, req *http.Request) *Conn { return new(Conn) })
+
+	var buf bytes.Buffer
+	assert.NoError(inj.Graph().WriteJSON(&buf))
+	var g Graph
+	assert.NoError(json.Unmarshal(buf.Bytes(), &g))
+	assert.True(len(g.Nodes) == 2)
+	assert.True(g.Nodes[0].Type == "inject.Conn" && len(g.Nodes[0].Deps) == 2)
+	assert.True(g.Nodes[1].Lifetime == "singleton")
+
+	// graph is a copy of deps
+	inj.Graph().Nodes[0].Deps[0] = "missing"
+	assert.True(inj.Graph().Nodes[0].Deps[0] == "inject:DB:")
+
+	buf.Reset()
+	assert.NoError(inj.Graph().WriteDOT(&buf))
+	dot := buf.String()
+	assert.True(strings.HasPrefix(dot, "digraph inject {"))
+	assert.True(strings.Contains(dot, `"inject:Conn:" -> "inject:DB:";`))
+	assert.True(strings.Contains(dot, `"net/http:Request:" [style=dashed];`))
+}
+
+func Test_Concurrent(t *testing.T) {
+	assert := &Assert{T: t}
+
+	var built int32
+	inj := CreateProvide()
+	inj.Provide(Object{Value: func(log *Log) *Service {
+		atomic.AddInt32(&built, 1)
+		time.Sleep(time.Millisecond)
+		return new(Service)
+	}, Lifetime: Singleton})
+
+	// goroutines report errors, assert run on the test goroutine only
+	var wg sync.WaitGroup
+	services := make([]*Service, 50)
+	errs := make(chan error, len(services)*4)
+	for i := range services {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var child Child
+			if err := inj.Apply(&child); err != nil {
+				errs <- err
+			} else if child.Single == nil {
+				errs <- fmt.Errorf("single of child not injected")
+			}
+			if _, err := inj.Invoke(func(req *http.Request, log Logger) {}); err != nil {
+				errs <- err
+			}
+			if err := inj.Find(&services[i], ""); err != nil {
+				errs <- err
+			}
+
+			scope := inj.NewScope()
+			req, _ := http.NewRequest("GET", "http://localhost/", nil)
+			scope.Provide(req)
+			var log *Log
+			if err := scope.Find(&log, ""); err != nil {
+				errs <- err
+			} else if log.req != req {
+				errs <- fmt.Errorf("log of scope not built with its request")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(err)
+	}
+
+	assert.True(atomic.LoadInt32(&built) == 1)
+	for _, s := range services {
+		assert.True(s == services[0])
+	}
+}
+
+func Test_ConcurrentScoped(t *testing.T) {
+	assert := &Assert{T: t}
+
+	var built int32
+	inj := New()
+	inj.Provide(func() *Single {
+		atomic.AddInt32(&built, 1)
+		time.Sleep(time.Millisecond)
+		return new(Single)
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var single *Single
+			if err := inj.Find(&single, ""); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(err)
+	}
+	assert.True(atomic.LoadInt32(&built) == 1)
+	assert.NoError(inj.Close(context.Background()))
+}
+
+func Test_ProviderError(t *testing.T) {
+	assert := &Assert{T: t}
+
+	errConnect := errors.New("connect refused")
+	var closed []string
+	inj := New()
+	inj.Provide(func() (*DB, error) {
+		return nil, errConnect
+	})
+	inj.Provide(func(db *DB) (*Log, func(), error) {
+		return new(Log), func() { closed = append(closed, "log") }, nil
+	})
+
+	obj := &struct {
+		Base
+	}{}
+	err := inj.Apply(obj)
+	assert.Error(err)
+	assert.True(errors.Is(err, errConnect))
+
+	var re *ResolveError
+	assert.True(errors.As(err, &re))
+	assert.True(strings.Join(re.Path, ",") == "struct { inject.Base }.Base,inject.Base.Log,inject:Log:,inject:DB:")
+	assert.True(obj.Log == nil)
+
+	// failed instance is not cached
+	var db *DB
+	err = inj.Find(&db, "")
+	assert.True(errors.Is(err, errConnect))
+	assert.True(db == nil)
+
+	_, err = inj.Invoke(func(log *Log) {})
+	assert.True(errors.Is(err, errConnect))
+
+	inj.Provide(func() (*DB, error) {
+		return &DB{closed: &closed}, nil
+	})
+	var log *Log
+	assert.NoError(inj.Find(&log, ""))
+	assert.NotNil(log)
+	inj.Close(context.Background())
+	assert.True(strings.Join(closed, ",") == "log,db")
+}
+
+func Test_ApplyNestedMissing(t *testing.T) {
+	assert := &Assert{T: t}
+
+	obj := &struct {
+		Base
+		Name string
+	}{}
+	inj := New()
+	inj.Provide(&Log{})
+	err := inj.Apply(obj)
+	assert.Error(err)
+
+	var re *ResolveError
+	assert.True(errors.As(err, &re))
+	assert.True(len(re.Path) == 2 && re.Path[1] == "inject.Base.Logger")
+	assert.True(strings.Contains(err.Error(), "provider not found"))
+}
+
 type Assert struct {
 	T *testing.T
 }
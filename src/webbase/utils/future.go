@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+)
+
+// Future is the result of a task submitted by Submit
+type Future[T any] interface {
+	// Get block until the task is done
+	Get() (T, error)
+	// GetContext return ctx.Err() if context done before the task
+	GetContext(ctx context.Context) (T, error)
+	// Done is closed when the task is done
+	Done() <-chan struct{}
+}
+
+// Submit run fn on worker and capture its result, the error of fn is
+// also reported by Wait of the worker
+func Submit[T any](w *Worker, fn func() (T, error)) Future[T] {
+	f := &future[T]{done: make(chan struct{})}
+	task := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = newPanicError(r)
+				f.resolve(*new(T), err)
+			}
+		}()
+		v, err := fn()
+		f.resolve(v, err)
+		return err
+	}
+
+	drop := func(err error) {
+		f.resolve(*new(T), err)
+	}
+	if err := w.submit(&workerTask{task: task, drop: drop}, true); err != nil {
+		drop(err)
+	}
+	return f
+}
+
+type future[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+func (f *future[T]) resolve(v T, err error) {
+	f.val, f.err = v, err
+	close(f.done)
+}
+
+func (f *future[T]) Get() (T, error) {
+	<-f.done
+	return f.val, f.err
+}
+
+func (f *future[T]) GetContext(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (f *future[T]) Done() <-chan struct{} {
+	return f.done
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmit(t *testing.T) {
+	worker := NewWorker(3, ContinueOnError())
+	futures := make([]Future[int], 0, 10)
+	for i := 0; i < 10; i++ {
+		index := i
+		futures = append(futures, Submit(worker, func() (int, error) {
+			return index * index, nil
+		}))
+	}
+	for i, f := range futures {
+		v, err := f.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, i*i, v)
+	}
+	assert.NoError(t, worker.Wait())
+
+	failed := Submit(worker, func() (string, error) {
+		return "", errors.New("test")
+	})
+	_, err := failed.Get()
+	assert.EqualError(t, err, "test")
+	assert.Error(t, worker.Wait())
+}
+
+func TestSubmitPanic(t *testing.T) {
+	worker := NewWorker(1)
+	f := Submit(worker, func() (int, error) {
+		panic("boom")
+	})
+	_, err := f.Get()
+
+	var perr *PanicError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, "boom", perr.Value)
+	assert.True(t, errors.As(worker.Wait(), &perr))
+}
+
+func TestSubmitClosed(t *testing.T) {
+	worker := NewWorker(1)
+	worker.Close()
+	_, err := Submit(worker, func() (int, error) {
+		return 1, nil
+	}).Get()
+	assert.Equal(t, ErrWorkerClosed, err)
+}
+
+func TestFutureGetContext(t *testing.T) {
+	worker := NewWorker(1)
+	release := make(chan struct{})
+	f := Submit(worker, func() (int, error) {
+		<-release
+		return 1, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := f.GetContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	<-f.Done()
+	v, err := f.GetContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	worker.Wait()
+}
@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Stage of a Pipeline, Fn transform an item of the previous stage
+type Stage struct {
+	Name string
+	// Workers is the concurrency of the stage, default to 1
+	Workers int
+	// Buffer is the size of the channel to the next stage
+	Buffer int
+	Fn     func(ctx context.Context, item interface{}) (interface{}, error)
+}
+
+// chain of stages connected by bounded channels, every stage run its
+// items on its own Worker
+type Pipeline struct {
+	stages  []Stage
+	ordered bool
+}
+
+type PipelineOption func(*Pipeline)
+
+// Ordered emit the output in the order of the source, items finished
+// early are held until the previous ones are emitted, the source is
+// paused while as many items as the workers and buffers of all stages
+// are in flight, so held items are bounded
+func Ordered() PipelineOption {
+	return func(p *Pipeline) {
+		p.ordered = true
+	}
+}
+
+func NewPipeline(stages []Stage, opts ...PipelineOption) *Pipeline {
+	p := &Pipeline{stages: make([]Stage, len(stages))}
+	for i, st := range stages {
+		if st.Name == "" {
+			st.Name = fmt.Sprintf("stage-%d", i)
+		}
+		if st.Workers <= 0 {
+			st.Workers = 1
+		}
+		p.stages[i] = st
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+type pipelineItem struct {
+	seq int
+	val interface{}
+}
+
+type pipelineRun struct {
+	once   sync.Once
+	err    error
+	cancel context.CancelFunc
+}
+
+// fail keep the first error and tear down every stage
+func (r *pipelineRun) fail(err error) {
+	r.once.Do(func() {
+		r.err = err
+	})
+	r.cancel()
+}
+
+// Run feed the items of source through the stages, the output must be
+// read until it is closed before calling wait, wait return the first
+// error of stages as TaskError with the stage name, or ctx.Err()
+func (p *Pipeline) Run(ctx context.Context, source <-chan interface{}) (output <-chan interface{}, wait func() error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	r := &pipelineRun{cancel: cancel}
+
+	// slots of items in flight in ordered mode, taken by feed and
+	// given back by emit
+	var window chan struct{}
+	if p.ordered {
+		size := 0
+		for _, st := range p.stages {
+			size += st.Workers + st.Buffer
+		}
+		window = make(chan struct{}, max(size, 1))
+	}
+
+	feed := make(chan pipelineItem)
+	go func() {
+		defer close(feed)
+		for seq := 0; ; seq++ {
+			if window != nil {
+				select {
+				case window <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case val, ok := <-source:
+				if !ok {
+					return
+				}
+				select {
+				case feed <- pipelineItem{seq: seq, val: val}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	in := feed
+	for _, st := range p.stages {
+		out := make(chan pipelineItem, st.Buffer)
+		wg.Add(1)
+		go func(st Stage, in <-chan pipelineItem, out chan<- pipelineItem) {
+			defer wg.Done()
+			defer close(out)
+			p.runStage(ctx, parent, r, st, in, out)
+		}(st, in, out)
+		in = out
+	}
+
+	final := make(chan interface{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(final)
+		p.emit(ctx, in, final, window)
+	}()
+
+	wait = func() error {
+		wg.Wait()
+		cancel()
+		if r.err != nil {
+			return r.err
+		}
+		return parent.Err()
+	}
+	return final, wait
+}
+
+func (p *Pipeline) runStage(ctx, parent context.Context, r *pipelineRun, st Stage, in <-chan pipelineItem, out chan<- pipelineItem) {
+	worker := NewWorkerContext(ctx, st.Workers)
+	defer worker.Wait()
+
+	fail := func(err error) {
+		// the error of a cancelled parent is returned by wait as it is
+		if parent.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			r.cancel()
+			return
+		}
+		r.fail(&TaskError{ID: st.Name, Err: err})
+	}
+
+	for {
+		var item pipelineItem
+		var ok bool
+		select {
+		case item, ok = <-in:
+		case <-ctx.Done():
+		}
+		if !ok {
+			return
+		}
+
+		err := worker.RunNamedTask(st.Name, func(ctx context.Context) error {
+			// the worker recover the panic but only close itself, tear
+			// down the other stages too
+			defer func() {
+				if v := recover(); v != nil {
+					err := newPanicError(v)
+					fail(err)
+					panic(err)
+				}
+			}()
+
+			val, err := st.Fn(ctx, item.val)
+			if err != nil {
+				fail(err)
+				return err
+			}
+			select {
+			case out <- pipelineItem{seq: item.seq, val: val}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// emit forward items of the last stage, reorder them in ordered mode
+func (p *Pipeline) emit(ctx context.Context, in <-chan pipelineItem, out chan<- interface{}, window <-chan struct{}) {
+	send := func(val interface{}) bool {
+		select {
+		case out <- val:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	next := 0
+	pending := make(map[int]interface{})
+	for item := range in {
+		if !p.ordered {
+			if !send(item.val) {
+				return
+			}
+			continue
+		}
+
+		pending[item.seq] = item.val
+		for {
+			val, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if !send(val) {
+				return
+			}
+			<-window
+		}
+	}
+}
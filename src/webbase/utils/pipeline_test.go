@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func numbers(n int) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+	}()
+	return ch
+}
+
+func jitterDouble(ctx context.Context, item interface{}) (interface{}, error) {
+	time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+	return item.(int) * 2, nil
+}
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline([]Stage{
+		{Name: "double", Workers: 4, Buffer: 2, Fn: jitterDouble},
+		{Name: "inc", Workers: 2, Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			return item.(int) + 1, nil
+		}},
+	})
+	output, wait := p.Run(context.Background(), numbers(50))
+
+	seen := make(map[int]bool)
+	for v := range output {
+		seen[v.(int)] = true
+	}
+	assert.NoError(t, wait())
+	assert.Len(t, seen, 50)
+	for i := 0; i < 50; i++ {
+		assert.True(t, seen[i*2+1])
+	}
+}
+
+func TestPipelineOrdered(t *testing.T) {
+	p := NewPipeline([]Stage{
+		{Workers: 8, Fn: jitterDouble},
+	}, Ordered())
+	output, wait := p.Run(context.Background(), numbers(50))
+
+	i := 0
+	for v := range output {
+		assert.Equal(t, i*2, v)
+		i++
+	}
+	assert.NoError(t, wait())
+	assert.Equal(t, 50, i)
+}
+
+func TestPipelineOrderedBackpressure(t *testing.T) {
+	var read int32
+	source := make(chan interface{})
+	go func() {
+		defer close(source)
+		for i := 0; i < 1000; i++ {
+			source <- i
+			atomic.AddInt32(&read, 1)
+		}
+	}()
+
+	// the head item is slow, items behind it must not pile up
+	p := NewPipeline([]Stage{
+		{Workers: 4, Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			if item.(int) == 0 {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return item, nil
+		}},
+	}, Ordered())
+	output, wait := p.Run(context.Background(), source)
+
+	assert.Equal(t, 0, <-output)
+	assert.LessOrEqual(t, atomic.LoadInt32(&read), int32(4+1))
+	i := 1
+	for v := range output {
+		assert.Equal(t, i, v)
+		i++
+	}
+	assert.NoError(t, wait())
+	assert.Equal(t, 1000, i)
+}
+
+func TestPipelineError(t *testing.T) {
+	p := NewPipeline([]Stage{
+		{Name: "read", Workers: 2, Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			return item, nil
+		}},
+		{Name: "write", Workers: 2, Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			if item.(int) == 10 {
+				return nil, errors.New("disk full")
+			}
+			return item, nil
+		}},
+	})
+	// endless source, the error must tear it down
+	source := make(chan interface{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case source <- i:
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}()
+	output, wait := p.Run(context.Background(), source)
+	for range output {
+	}
+
+	err := wait()
+	var terr *TaskError
+	assert.True(t, errors.As(err, &terr))
+	assert.Equal(t, "write", terr.ID)
+	assert.EqualError(t, terr.Err, "disk full")
+}
+
+func TestPipelinePanic(t *testing.T) {
+	p := NewPipeline([]Stage{
+		{Name: "read", Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			return item, nil
+		}},
+		{Name: "parse", Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			if item.(int) == 3 {
+				panic("bad item")
+			}
+			return item, nil
+		}},
+	})
+	output, wait := p.Run(context.Background(), numbers(1000))
+	for range output {
+	}
+
+	err := wait()
+	var terr *TaskError
+	assert.True(t, errors.As(err, &terr))
+	assert.Equal(t, "parse", terr.ID)
+	var perr *PanicError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, "bad item", perr.Value)
+}
+
+func TestPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPipeline([]Stage{
+		{Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			return item, nil
+		}},
+	})
+	output, wait := p.Run(ctx, numbers(1000))
+	<-output
+	cancel()
+	for range output {
+	}
+	assert.Equal(t, context.Canceled, wait())
+
+	// stage returning ctx.Err() after the parent is cancelled
+	ctx, cancel = context.WithCancel(context.Background())
+	p = NewPipeline([]Stage{
+		{Fn: func(ctx context.Context, item interface{}) (interface{}, error) {
+			if item.(int) > 0 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return item, nil
+		}},
+	})
+	output, wait = p.Run(ctx, numbers(1000))
+	<-output
+	cancel()
+	for range output {
+	}
+	assert.Equal(t, context.Canceled, wait())
+}
@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrRateLimitExceeded = errors.New("rate limit exceeded")
+
+// rate limiter of events
+type RateLimiter interface {
+	// Allow return true if an event may happen now
+	Allow() bool
+	// Wait block until an event may happen, return error if context done
+	Wait(ctx context.Context) error
+	// Reserve a future event, the caller should wait Delay before acting
+	Reserve() *Reservation
+}
+
+// Reservation of an event by RateLimiter.Reserve
+type Reservation struct {
+	ok     bool
+	delay  time.Duration
+	cancel func()
+}
+
+// OK return false if the limiter can never allow the event
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay return the duration to wait before the event
+func (r *Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// Cancel give the reserved event back to the limiter
+func (r *Reservation) Cancel() {
+	if r.ok && r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+func waitReservation(ctx context.Context, r *Reservation) error {
+	if !r.OK() {
+		return ErrRateLimitExceeded
+	}
+	if r.Delay() <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(r.Delay())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// NewTokenBucket allow rate events per second with bursts of burst events
+func NewTokenBucket(rate float64, burst int) RateLimiter {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// advance refill tokens up to now, must hold b.mu
+func (b *tokenBucket) advance() time.Time {
+	now := b.now()
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+	return now
+}
+
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	return waitReservation(ctx, b.Reserve())
+}
+
+func (b *tokenBucket) Reserve() *Reservation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	if b.tokens < 1 && b.rate <= 0 {
+		return &Reservation{}
+	}
+
+	// tokens go negative to queue reservations
+	b.tokens--
+	r := &Reservation{ok: true, cancel: func() {
+		b.mu.Lock()
+		b.tokens++
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.mu.Unlock()
+	}}
+	if b.tokens < 0 {
+		r.delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return r
+}
+
+// NewSlidingWindow allow limit events in any window of time
+func NewSlidingWindow(limit int, window time.Duration) RateLimiter {
+	return &slidingWindow{limit: limit, window: window, now: time.Now}
+}
+
+type slidingWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	// sorted times of allowed and reserved events in the window
+	events []time.Time
+	now    func() time.Time
+}
+
+// next return the earliest time of a new event, must hold w.mu
+func (w *slidingWindow) next() (now, at time.Time) {
+	now = w.now()
+	expired := sort.Search(len(w.events), func(i int) bool {
+		return w.events[i].After(now.Add(-w.window))
+	})
+	w.events = w.events[expired:]
+
+	at = now
+	if len(w.events) >= w.limit {
+		if t := w.events[len(w.events)-w.limit].Add(w.window); t.After(at) {
+			at = t
+		}
+	}
+	return
+}
+
+func (w *slidingWindow) Allow() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.limit <= 0 {
+		return false
+	}
+	now, at := w.next()
+	if at.After(now) {
+		return false
+	}
+	w.events = append(w.events, at)
+	return true
+}
+
+func (w *slidingWindow) Wait(ctx context.Context) error {
+	return waitReservation(ctx, w.Reserve())
+}
+
+func (w *slidingWindow) Reserve() *Reservation {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.limit <= 0 {
+		return &Reservation{}
+	}
+	now, at := w.next()
+	w.events = append(w.events, at)
+	return &Reservation{ok: true, delay: at.Sub(now), cancel: func() {
+		w.mu.Lock()
+		for i := len(w.events) - 1; i >= 0; i-- {
+			if w.events[i].Equal(at) {
+				w.events = append(w.events[:i], w.events[i+1:]...)
+				break
+			}
+		}
+		w.mu.Unlock()
+	}}
+}
+
+// rate limiters keyed by client, limiters unused for idle are evicted,
+// idle should be long enough for a limiter to recover fully
+type RateLimiterGroup struct {
+	mu       sync.Mutex
+	create   func() RateLimiter
+	idle     time.Duration
+	limiters map[string]*keyedLimiter
+	swept    time.Time
+	now      func() time.Time
+}
+
+type keyedLimiter struct {
+	limiter RateLimiter
+	used    time.Time
+}
+
+func NewRateLimiterGroup(create func() RateLimiter, idle time.Duration) *RateLimiterGroup {
+	return &RateLimiterGroup{
+		create:   create,
+		idle:     idle,
+		limiters: make(map[string]*keyedLimiter),
+		now:      time.Now,
+	}
+}
+
+// Get return the limiter of key, create it if not exists
+func (g *RateLimiterGroup) Get(key string) RateLimiter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	if now.Sub(g.swept) >= g.idle {
+		for k, l := range g.limiters {
+			if now.Sub(l.used) >= g.idle {
+				delete(g.limiters, k)
+			}
+		}
+		g.swept = now
+	}
+
+	l, ok := g.limiters[key]
+	if !ok {
+		l = &keyedLimiter{limiter: g.create()}
+		g.limiters[key] = l
+	}
+	l.used = now
+	return l.limiter
+}
+
+func (g *RateLimiterGroup) Allow(key string) bool {
+	return g.Get(key).Allow()
+}
+
+func (g *RateLimiterGroup) Wait(ctx context.Context, key string) error {
+	return g.Get(key).Wait(ctx)
+}
+
+func (g *RateLimiterGroup) Reserve(key string) *Reservation {
+	return g.Get(key).Reserve()
+}
+
+// Len return the number of keys not evicted
+func (g *RateLimiterGroup) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.limiters)
+}
+
+// RemoteIPKey use the client ip as the key of rate limit
+func RemoteIPKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitHandler reply 429 Too Many Requests when the limiter of the
+// request key does not allow it
+func RateLimitHandler(g *RateLimiterGroup, key func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.Allow(key(r)) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNow struct {
+	t time.Time
+}
+
+func (f *fakeNow) now() time.Time {
+	return f.t
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeNow{t: time.Now()}
+	limiter := NewTokenBucket(10, 2)
+	limiter.(*tokenBucket).now = clock.now
+
+	assert.True(t, limiter.Allow())
+	assert.True(t, limiter.Allow())
+	assert.False(t, limiter.Allow())
+
+	clock.t = clock.t.Add(100 * time.Millisecond)
+	assert.True(t, limiter.Allow())
+	assert.False(t, limiter.Allow())
+
+	r := limiter.Reserve()
+	assert.True(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.Delay())
+	r.Cancel()
+	r = limiter.Reserve()
+	assert.Equal(t, 100*time.Millisecond, r.Delay())
+
+	// refill is capped by burst
+	clock.t = clock.t.Add(time.Hour)
+	assert.True(t, limiter.Allow())
+	assert.True(t, limiter.Allow())
+	assert.False(t, limiter.Allow())
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	limiter := NewTokenBucket(1000, 1)
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	limiter = NewTokenBucket(1, 1)
+	limiter.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx))
+
+	assert.False(t, NewTokenBucket(0, 0).Reserve().OK())
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := &fakeNow{t: time.Now()}
+	limiter := NewSlidingWindow(2, time.Second)
+	limiter.(*slidingWindow).now = clock.now
+
+	assert.True(t, limiter.Allow())
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	assert.True(t, limiter.Allow())
+	assert.False(t, limiter.Allow())
+
+	r := limiter.Reserve()
+	assert.True(t, r.OK())
+	assert.Equal(t, 500*time.Millisecond, r.Delay())
+
+	// the first event slide out of the window, but it is reserved
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	assert.False(t, limiter.Allow())
+	r.Cancel()
+	assert.True(t, limiter.Allow())
+}
+
+func TestRateLimiterGroup(t *testing.T) {
+	clock := &fakeNow{t: time.Now()}
+	group := NewRateLimiterGroup(func() RateLimiter {
+		return NewSlidingWindow(1, time.Minute)
+	}, time.Minute)
+	group.now = clock.now
+
+	assert.True(t, group.Allow("a"))
+	assert.False(t, group.Allow("a"))
+	assert.True(t, group.Allow("b"))
+	assert.Equal(t, 2, group.Len())
+
+	clock.t = clock.t.Add(30 * time.Second)
+	assert.False(t, group.Allow("a"))
+
+	// b is idle for a minute and evicted
+	clock.t = clock.t.Add(40 * time.Second)
+	group.Get("a")
+	assert.Equal(t, 1, group.Len())
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	group := NewRateLimiterGroup(func() RateLimiter {
+		return NewTokenBucket(0, 1)
+	}, time.Minute)
+	handler := RateLimitHandler(group, RemoteIPKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(addr string) int {
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.1:5678"))
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2:1234"))
+}
@@ -0,0 +1,126 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Policy of retrying a function, zero fields use the default values
+type Policy struct {
+	// MaxAttempts including the first call, default to 3, -1 retry until
+	// context done
+	MaxAttempts int
+	// InitialInterval before the first retry, default to 100ms
+	InitialInterval time.Duration
+	// MaxInterval cap the growing interval, default to 10s
+	MaxInterval time.Duration
+	// Multiplier of the interval after each retry, default to 2
+	Multiplier float64
+	// Jitter randomize the interval by +/- Jitter fraction, in [0, 1]
+	Jitter float64
+	// Retryable classify errors, nil retry every error except Permanent
+	Retryable func(error) bool
+}
+
+var DefaultPolicy = Policy{
+	MaxAttempts:     3,
+	InitialInterval: 100 * time.Millisecond,
+	MaxInterval:     10 * time.Second,
+	Multiplier:      2,
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultPolicy.MaxAttempts
+	}
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = DefaultPolicy.InitialInterval
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = DefaultPolicy.MaxInterval
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultPolicy.Multiplier
+	}
+	return p
+}
+
+// Backoff return the interval before retry n, n start from 1
+func (p Policy) Backoff(n int) time.Duration {
+	p = p.withDefaults()
+	interval := float64(p.InitialInterval)
+	for i := 1; i < n && interval < float64(p.MaxInterval); i++ {
+		interval *= p.Multiplier
+	}
+	if interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		interval += interval * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(interval)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent mark err as not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func (p Policy) retryable(err error) bool {
+	var perr *permanentError
+	if errors.As(err, &perr) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return true
+}
+
+// Do call fn until it succeed, it return a not retryable error or the
+// attempts are exhausted, the last error of fn is returned, or ctx.Err()
+// if context done while waiting to retry
+func Do(ctx context.Context, p Policy, fn func(context.Context) error) error {
+	p = p.withDefaults()
+	for n := 1; ; n++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if !p.retryable(err) {
+			var perr *permanentError
+			if errors.As(err, &perr) && perr == err {
+				return perr.err
+			}
+			return err
+		}
+		if p.MaxAttempts > 0 && n >= p.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(p.Backoff(n))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
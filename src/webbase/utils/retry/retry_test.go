@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fast = Policy{
+	MaxAttempts:     5,
+	InitialInterval: time.Microsecond,
+	MaxInterval:     time.Millisecond,
+}
+
+func TestDo(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), fast, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestDoMaxAttempts(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), fast, func(ctx context.Context) error {
+		calls++
+		return errors.New("down")
+	})
+	assert.EqualError(t, err, "down")
+	assert.Equal(t, 5, calls)
+}
+
+func TestDoNotRetryable(t *testing.T) {
+	notFound := errors.New("not found")
+	calls := 0
+	err := Do(context.Background(), fast, func(ctx context.Context) error {
+		calls++
+		return Permanent(notFound)
+	})
+	assert.Equal(t, notFound, err)
+	assert.Equal(t, 1, calls)
+
+	p := fast
+	p.Retryable = func(err error) bool {
+		return err != notFound
+	}
+	calls = 0
+	err = Do(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		return notFound
+	})
+	assert.Equal(t, notFound, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDoContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	p := Policy{MaxAttempts: -1, InitialInterval: time.Millisecond}
+	err := Do(ctx, p, func(ctx context.Context) error {
+		return errors.New("down")
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+	assert.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, p.Backoff(2))
+	assert.Equal(t, 800*time.Millisecond, p.Backoff(4))
+	assert.Equal(t, time.Second, p.Backoff(10))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(1)
+		assert.True(t, d >= 50*time.Millisecond && d <= 150*time.Millisecond)
+	}
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	gosync "gosync"
+)
+
+var ErrSchedulerStopped = errors.New("scheduler stopped")
+
+// Job run by Scheduler, a run is skipped while the previous run of the
+// same job is not finished
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Fn       func(ctx context.Context) error
+	// Jitter delay every run by a random duration in [0, Jitter)
+	Jitter time.Duration
+}
+
+type SchedulerOption func(*Scheduler)
+
+// WithClock replace the real clock, use FakeClock in tests
+func WithClock(clock Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithJobLocks prevent overlapping runs with locks, use a distributed
+// MutexGroup to prevent overlaps across replicas
+func WithJobLocks(locks gosync.MutexGroup) SchedulerOption {
+	return func(s *Scheduler) {
+		s.locks = locks
+	}
+}
+
+// WithErrorHandler receive errors of jobs, default to log
+func WithErrorHandler(fn func(name string, err error)) SchedulerOption {
+	return func(s *Scheduler) {
+		s.onError = fn
+	}
+}
+
+// run jobs on fixed interval or cron schedules
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]Job
+	started bool
+	stopped bool
+
+	clock   Clock
+	locks   gosync.MutexGroup
+	onError func(name string, err error)
+
+	// ctx stop scheduling, jobCtx is given to running jobs
+	ctx       context.Context
+	cancel    context.CancelFunc
+	jobCtx    context.Context
+	jobCancel context.CancelFunc
+
+	loops   sync.WaitGroup
+	running sync.WaitGroup
+}
+
+func NewScheduler(opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		jobs:  make(map[string]Job),
+		clock: RealClock(),
+		locks: gosync.NewMutexGroup(),
+		onError: func(name string, err error) {
+			log.Printf("job %s: %v", name, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.jobCtx, s.jobCancel = context.WithCancel(context.Background())
+	return s
+}
+
+// Add register a job, it is scheduled at once if the scheduler is started
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Fn == nil {
+		return fmt.Errorf("job need name, schedule and fn")
+	}
+	// a schedule which does not move forward would spin the job loop
+	if now := s.clock.Now(); !job.Schedule.Next(now).After(now) {
+		return fmt.Errorf("job %s schedule has no next time after %v", job.Name, now)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrSchedulerStopped
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s already exists", job.Name)
+	}
+	s.jobs[job.Name] = job
+	if s.started {
+		s.loop(job)
+	}
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, job := range s.jobs {
+		s.loop(job)
+	}
+}
+
+// Stop stop scheduling and wait running jobs, the context of jobs is
+// cancelled when ctx is done and ctx.Err() is returned
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.jobCancel()
+		return nil
+	case <-ctx.Done():
+		s.jobCancel()
+		return ctx.Err()
+	}
+}
+
+// loop must hold s.mu
+func (s *Scheduler) loop(job Job) {
+	s.loops.Add(1)
+	go func() {
+		defer s.loops.Done()
+		for {
+			now := s.clock.Now()
+			next := job.Schedule.Next(now)
+			if next.IsZero() {
+				return
+			}
+			if job.Jitter > 0 {
+				next = next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+			}
+
+			timer := s.clock.NewTimer(next.Sub(now))
+			select {
+			case <-timer.C():
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			}
+			s.run(job)
+		}
+	}()
+}
+
+// run skip the job if it is still running
+func (s *Scheduler) run(job Job) {
+	if !s.locks.TryLock(job.Name) {
+		return
+	}
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer s.locks.UnLock(job.Name)
+
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = newPanicError(r)
+				}
+			}()
+			return job.Fn(s.jobCtx)
+		}()
+		if err != nil {
+			s.onError(job.Name, err)
+		}
+	}()
+}
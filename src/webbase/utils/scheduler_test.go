@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerEvery(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	s := NewScheduler(WithClock(clock))
+	runs := make(chan time.Time, 10)
+	s.Add(Job{Name: "tick", Schedule: Every(time.Minute), Fn: func(ctx context.Context) error {
+		runs <- clock.Now()
+		return nil
+	}})
+	s.Start()
+
+	for i := 1; i <= 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		assert.Equal(t, time.Date(2024, 1, 15, 10, i, 0, 0, time.UTC), <-runs)
+	}
+	assert.NoError(t, s.Stop(context.Background()))
+}
+
+func TestSchedulerRejectEmptyInterval(t *testing.T) {
+	s := NewScheduler()
+	fn := func(ctx context.Context) error { return nil }
+	assert.Error(t, s.Add(Job{Name: "zero", Schedule: Every(0), Fn: fn}))
+	assert.Error(t, s.Add(Job{Name: "negative", Schedule: Every(-time.Second), Fn: fn}))
+	assert.NoError(t, s.Add(Job{Name: "tick", Schedule: Every(time.Second), Fn: fn}))
+}
+
+func TestSchedulerCron(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	s := NewScheduler(WithClock(clock))
+	daily, _ := ParseCron("30 2 * * *")
+	runs := make(chan time.Time, 10)
+	s.Add(Job{Name: "report", Schedule: daily, Fn: func(ctx context.Context) error {
+		runs <- clock.Now()
+		return nil
+	}})
+	s.Start()
+
+	clock.BlockUntil(1)
+	clock.Advance(16*time.Hour + 30*time.Minute)
+	assert.Equal(t, time.Date(2024, 1, 16, 2, 30, 0, 0, time.UTC), <-runs)
+	s.Stop(context.Background())
+}
+
+func TestSchedulerSkipOverlap(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var errs int32
+	s := NewScheduler(WithClock(clock), WithErrorHandler(func(name string, err error) {
+		atomic.AddInt32(&errs, 1)
+	}))
+
+	var runs int32
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	s.Add(Job{Name: "slow", Schedule: Every(time.Second), Fn: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		started <- struct{}{}
+		<-release
+		return errors.New("test")
+	}})
+	s.Start()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-started
+	// the first run is still running, next runs are skipped
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+	}
+	clock.BlockUntil(1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	close(release)
+	assert.NoError(t, s.Stop(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&errs))
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	s := NewScheduler(WithClock(clock))
+	runs := make(chan struct{}, 1)
+	s.Add(Job{Name: "jitter", Schedule: Every(time.Minute), Jitter: 10 * time.Second, Fn: func(ctx context.Context) error {
+		runs <- struct{}{}
+		return nil
+	}})
+	s.Start()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute - time.Second)
+	select {
+	case <-runs:
+		t.Fatal("job cannot run before its schedule")
+	default:
+	}
+	clock.Advance(11 * time.Second)
+	<-runs
+	s.Stop(context.Background())
+}
+
+func TestSchedulerStopTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	s := NewScheduler(WithClock(clock))
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	s.Add(Job{Name: "stuck", Schedule: Every(time.Second), Fn: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil
+	}})
+	s.Start()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Stop(ctx))
+	<-cancelled
+	assert.Equal(t, ErrSchedulerStopped, s.Add(Job{Name: "late", Schedule: Every(time.Second), Fn: func(ctx context.Context) error {
+		return nil
+	}}))
+}
@@ -1,80 +1,365 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
+
+	"webbase/utils/retry"
+)
+
+var (
+	ErrWorkerClosed = errors.New("worker closed")
+	ErrQueueFull    = errors.New("worker queue full")
 )
 
+// TaskError is the error of a task run by RunNamedTask, ID is empty for
+// tasks without name in WorkerErrors
+type TaskError struct {
+	ID  string
+	Err error
+}
+
+func (e *TaskError) Error() string {
+	if e.ID == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("task %s: %v", e.ID, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// WorkerErrors is returned by Wait of a worker with ContinueOnError
+type WorkerErrors []*TaskError
+
+func (e WorkerErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d tasks failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e WorkerErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// PanicError is the error of a task which panics
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func newPanicError(v interface{}) *PanicError {
+	if err, ok := v.(*PanicError); ok {
+		return err
+	}
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panic: %v\n%s", e.Value, e.Stack)
+}
+
+type WorkerOption func(*Worker)
+
+// ContinueOnError keep running tasks after a task failed, Wait return
+// WorkerErrors with the error of every failed task
+func ContinueOnError() WorkerOption {
+	return func(w *Worker) {
+		w.continueOnError = true
+	}
+}
+
+// WithQueue let RunTask queue up to size tasks when all slots are busy
+// instead of blocking the caller
+func WithQueue(size int) WorkerOption {
+	return func(w *Worker) {
+		w.queueSize = size
+	}
+}
+
+// WorkerStats is a snapshot of worker counters
+type WorkerStats struct {
+	Limit     int
+	Running   int
+	Queued    int
+	Completed int64
+	Failed    int64
+	// average running time of completed tasks
+	AvgLatency time.Duration
+}
+
 // concurrent limit worker
-// task support func() and func() error
+// task support func(), func() error and func(context.Context) error
 type Worker struct {
-	rw     sync.RWMutex
+	mu     sync.Mutex
 	wg     sync.WaitGroup
 	err    error
+	errs   WorkerErrors
 	closed bool
 
-	pools chan struct{}
+	continueOnError bool
+
+	// parent context given by NewWorkerContext
+	parent context.Context
+	// ctx of tasks, cancelled on the first error or on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	limit     int
+	running   int
+	queue     []*workerTask
+	queueSize int
+	// closed and replaced when a slot or queue space is freed
+	notify chan struct{}
+
+	completed int64
+	failed    int64
+	latency   time.Duration
 }
 
-func (w *Worker) RunTask(task interface{}) {
-	w.rw.RLock()
-	if w.closed {
-		w.rw.RUnlock()
-		return
+type workerTask struct {
+	id   string
+	task interface{}
+	// called when the task is dropped from queue by Close
+	drop func(error)
+}
+
+// RunTask block until a slot or queue space is free, return
+// ErrWorkerClosed if the worker is closed or its context is done before that
+func (w *Worker) RunTask(task interface{}) error {
+	return w.RunNamedTask("", task)
+}
+
+// RunNamedTask is like RunTask, the error of task is reported with id
+func (w *Worker) RunNamedTask(id string, task interface{}) error {
+	return w.submit(&workerTask{id: id, task: task}, true)
+}
+
+// RunTaskWithRetry run task with retries by policy, the task receive
+// the context of worker which stop the retries when cancelled
+func (w *Worker) RunTaskWithRetry(p retry.Policy, task func(context.Context) error) error {
+	return w.RunTask(func(ctx context.Context) error {
+		return retry.Do(ctx, p, task)
+	})
+}
+
+// TrySubmit is like RunTask but return ErrQueueFull at once if no slot
+// or queue space is free
+func (w *Worker) TrySubmit(task interface{}) error {
+	return w.submit(&workerTask{task: task}, false)
+}
+
+func (w *Worker) submit(t *workerTask, block bool) error {
+	switch t.task.(type) {
+	case func(), func() error, func(context.Context) error:
+	default:
+		return fmt.Errorf("unsupport task type %T", t.task)
+	}
+
+	w.mu.Lock()
+	for {
+		if w.closed || w.ctx.Err() != nil {
+			w.mu.Unlock()
+			return ErrWorkerClosed
+		}
+		if w.running < w.limit {
+			w.running++
+			w.wg.Add(1)
+			w.mu.Unlock()
+			go w.run(t)
+			return nil
+		}
+		if len(w.queue) < w.queueSize {
+			w.queue = append(w.queue, t)
+			w.wg.Add(1)
+			w.mu.Unlock()
+			return nil
+		}
+		if !block {
+			w.mu.Unlock()
+			return ErrQueueFull
+		}
+
+		notify := w.notify
+		w.mu.Unlock()
+		select {
+		case <-notify:
+		case <-w.ctx.Done():
+		}
+		w.mu.Lock()
 	}
-	w.wg.Add(1)
-	w.pools <- struct{}{}
-	w.rw.RUnlock()
+}
+
+// Resize change the number of concurrent tasks, running tasks over the
+// new size are not interrupted
+func (w *Worker) Resize(nums int) {
+	w.mu.Lock()
+	w.limit = nums
+	w.schedule()
+	w.mu.Unlock()
+}
 
-	go w.run(task)
+// Stats return a snapshot of worker counters
+func (w *Worker) Stats() WorkerStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := WorkerStats{
+		Limit:     w.limit,
+		Running:   w.running,
+		Queued:    len(w.queue),
+		Completed: w.completed,
+		Failed:    w.failed,
+	}
+	if w.completed > 0 {
+		stats.AvgLatency = w.latency / time.Duration(w.completed)
+	}
+	return stats
 }
 
+// Wait return the first error of tasks, or WorkerErrors with ContinueOnError,
+// or the error of parent context if it is done
 func (w *Worker) Wait() (err error) {
 	w.wg.Wait()
+	w.mu.Lock()
 	err = w.err
 	w.err = nil
+	if len(w.errs) > 0 {
+		err = w.errs
+		w.errs = nil
+	}
+	w.mu.Unlock()
+	if err == nil {
+		err = w.parent.Err()
+	}
 	return
 }
 
+// Close cancel the context of running tasks, queued tasks are dropped and
+// tasks waiting in RunTask return ErrWorkerClosed
 func (w *Worker) Close() {
-	w.rw.Lock()
+	w.mu.Lock()
 	w.close()
-	w.rw.Unlock()
+	w.mu.Unlock()
 }
 
-func (w *Worker) run(task interface{}) {
+func (w *Worker) run(t *workerTask) {
+	start := time.Now()
+	err := w.call(t.task)
+
+	// record the error before Wait can return
+	w.mu.Lock()
+	w.completed++
+	w.latency += time.Since(start)
+	if err != nil {
+		w.failed++
+		w.fail(t.id, err)
+	}
+	w.running--
+	w.schedule()
+	w.mu.Unlock()
+
+	w.wg.Done()
+}
+
+// call run task and convert its panic to PanicError
+func (w *Worker) call(task interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+
 	switch t := task.(type) {
 	case func():
 		t()
-		w.done()
 	case func() error:
-		err := t()
-		w.done()
-		if err != nil {
-			w.rw.Lock()
-			if !w.closed {
-				w.close()
-				w.err = err
-			}
-			w.rw.Unlock()
+		err = t()
+	case func(context.Context) error:
+		err = t(w.ctx)
+	}
+	return
+}
+
+// schedule start queued tasks on free slots and wake up blocked
+// submitters, must hold w.mu
+func (w *Worker) schedule() {
+	if w.ctx.Err() != nil {
+		w.dropQueue(ErrWorkerClosed)
+	}
+	for w.running < w.limit && len(w.queue) > 0 {
+		t := w.queue[0]
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		w.running++
+		go w.run(t)
+	}
+	close(w.notify)
+	w.notify = make(chan struct{})
+}
+
+// dropQueue must hold w.mu
+func (w *Worker) dropQueue(err error) {
+	for _, t := range w.queue {
+		if t.drop != nil {
+			t.drop(err)
 		}
+		w.wg.Done()
 	}
+	w.queue = nil
 }
 
-func (w *Worker) done() {
-	<-w.pools
-	w.wg.Done()
+// fail must hold w.mu
+func (w *Worker) fail(id string, err error) {
+	if w.continueOnError {
+		w.errs = append(w.errs, &TaskError{ID: id, Err: err})
+		return
+	}
+	if !w.closed {
+		w.close()
+		if id != "" {
+			err = &TaskError{ID: id, Err: err}
+		}
+		w.err = err
+	}
 }
 
+// close must hold w.mu
 func (w *Worker) close() {
 	if w.closed {
 		return
 	}
 	w.closed = true
-	close(w.pools)
+	w.cancel()
+	w.dropQueue(ErrWorkerClosed)
+	close(w.notify)
+	w.notify = make(chan struct{})
 }
 
-func NewWorker(nums int) *Worker {
+func NewWorker(nums int, opts ...WorkerOption) *Worker {
+	return NewWorkerContext(context.Background(), nums, opts...)
+}
+
+// NewWorkerContext create a worker whose tasks are cancelled with ctx
+func NewWorkerContext(ctx context.Context, nums int, opts ...WorkerOption) *Worker {
 	wk := new(Worker)
-	wk.pools = make(chan struct{}, nums)
+	for _, opt := range opts {
+		opt(wk)
+	}
+	wk.parent = ctx
+	wk.ctx, wk.cancel = context.WithCancel(ctx)
+	wk.limit = nums
+	wk.notify = make(chan struct{})
 	return wk
 }
@@ -1,12 +1,17 @@
 package utils
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"runtime"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"webbase/utils/retry"
 )
 
 func init() {
@@ -74,3 +79,222 @@ func TestWorkerClose(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, worker.err)
 }
+
+func TestWorkerRunTaskAfterClose(t *testing.T) {
+	worker := NewWorker(1)
+	worker.Close()
+	assert.Equal(t, ErrWorkerClosed, worker.RunTask(func() {}))
+	assert.Error(t, worker.RunTask("not a task"))
+}
+
+func TestWorkerContextCancelOnError(t *testing.T) {
+	worker := NewWorkerContext(context.Background(), 2)
+	cancelled := make(chan struct{})
+	worker.RunTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return nil
+	})
+	worker.RunTask(func(ctx context.Context) error {
+		return errors.New("test")
+	})
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("running task should be cancelled on error")
+	}
+	assert.EqualError(t, worker.Wait(), "test")
+	assert.Equal(t, ErrWorkerClosed, worker.RunTask(func() {}))
+}
+
+func TestWorkerContextClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	worker := NewWorkerContext(ctx, 1)
+	worker.RunTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	// the pool is full, pending RunTask is abandoned by Close
+	pending := make(chan error, 1)
+	go func() {
+		pending <- worker.RunTask(func() {})
+	}()
+	time.Sleep(5 * time.Millisecond)
+	worker.Close()
+
+	assert.Equal(t, ErrWorkerClosed, <-pending)
+	assert.NoError(t, worker.Wait())
+}
+
+func TestWorkerParentContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	worker := NewWorkerContext(ctx, 1)
+	worker.RunTask(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	cancel()
+	assert.Equal(t, context.Canceled, worker.Wait())
+	assert.Equal(t, ErrWorkerClosed, worker.RunTask(func() {}))
+}
+
+func TestWorkerContinueOnError(t *testing.T) {
+	worker := NewWorker(5, ContinueOnError())
+	for i := 0; i < 20; i++ {
+		index := i
+		worker.RunNamedTask(fmt.Sprintf("provision-%d", index), func() error {
+			if index%5 == 0 {
+				return fmt.Errorf("failed %d", index)
+			}
+			return nil
+		})
+	}
+	err := worker.Wait()
+
+	var errs WorkerErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 4)
+	ids := make(map[string]bool)
+	for _, e := range errs {
+		ids[e.ID] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"provision-0": true, "provision-5": true, "provision-10": true, "provision-15": true,
+	}, ids)
+	assert.Contains(t, err.Error(), "4 tasks failed")
+
+	// errors are reset by Wait and the worker is still usable
+	assert.NoError(t, worker.RunTask(func() {}))
+	assert.NoError(t, worker.Wait())
+
+	// unnamed tasks are reported like the fail fast path
+	worker.RunTask(func() error { return errors.New("unnamed") })
+	assert.EqualError(t, worker.Wait(), "1 tasks failed: unnamed")
+}
+
+func TestWorkerNamedTaskError(t *testing.T) {
+	worker := NewWorker(1)
+	base := errors.New("test")
+	worker.RunNamedTask("db", func() error {
+		return base
+	})
+	err := worker.Wait()
+	assert.EqualError(t, err, "task db: test")
+	assert.True(t, errors.Is(err, base))
+}
+
+func TestWorkerPanic(t *testing.T) {
+	worker := NewWorker(2, ContinueOnError())
+	worker.RunNamedTask("ok", func() {})
+	worker.RunNamedTask("panic", func() {
+		panic("boom")
+	})
+	err := worker.Wait()
+
+	var perr *PanicError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, "boom", perr.Value)
+	assert.Contains(t, string(perr.Stack), "TestWorkerPanic")
+
+	// wait group is balanced after panic
+	assert.NoError(t, worker.RunTask(func() {}))
+	assert.NoError(t, worker.Wait())
+}
+
+func TestWorkerQueue(t *testing.T) {
+	worker := NewWorker(1, WithQueue(2))
+	release := make(chan struct{})
+	block := func() { <-release }
+
+	assert.NoError(t, worker.TrySubmit(block))
+	assert.NoError(t, worker.TrySubmit(block))
+	assert.NoError(t, worker.TrySubmit(block))
+	assert.Equal(t, ErrQueueFull, worker.TrySubmit(block))
+
+	stats := worker.Stats()
+	assert.Equal(t, 1, stats.Running)
+	assert.Equal(t, 2, stats.Queued)
+
+	close(release)
+	assert.NoError(t, worker.Wait())
+	stats = worker.Stats()
+	assert.Equal(t, 0, stats.Running)
+	assert.Equal(t, 0, stats.Queued)
+	assert.Equal(t, int64(3), stats.Completed)
+}
+
+func TestWorkerResize(t *testing.T) {
+	worker := NewWorker(1, WithQueue(10))
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		worker.RunTask(func() { <-release })
+	}
+	assert.Equal(t, 1, worker.Stats().Running)
+
+	worker.Resize(3)
+	stats := worker.Stats()
+	assert.Equal(t, 3, stats.Limit)
+	assert.Equal(t, 3, stats.Running)
+	assert.Equal(t, 1, stats.Queued)
+
+	worker.Resize(1)
+	close(release)
+	assert.NoError(t, worker.Wait())
+	assert.Equal(t, int64(4), worker.Stats().Completed)
+}
+
+func TestWorkerStatsFailed(t *testing.T) {
+	worker := NewWorker(2, ContinueOnError())
+	worker.RunTask(func() error {
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	})
+	worker.RunTask(func() error {
+		return errors.New("test")
+	})
+	worker.Wait()
+
+	stats := worker.Stats()
+	assert.Equal(t, int64(2), stats.Completed)
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.True(t, stats.AvgLatency >= time.Millisecond)
+}
+
+func TestWorkerCloseDropsQueue(t *testing.T) {
+	worker := NewWorker(1, WithQueue(1))
+	release := make(chan struct{})
+	worker.RunTask(func() { <-release })
+	queued := Submit(worker, func() (int, error) {
+		return 1, nil
+	})
+	worker.Close()
+
+	_, err := queued.Get()
+	assert.Equal(t, ErrWorkerClosed, err)
+	close(release)
+	assert.NoError(t, worker.Wait())
+	assert.Equal(t, int64(1), worker.Stats().Completed)
+}
+
+func TestWorkerRunTaskWithRetry(t *testing.T) {
+	worker := NewWorker(2)
+	calls := 0
+	policy := retry.Policy{MaxAttempts: 3, InitialInterval: time.Microsecond}
+	worker.RunTaskWithRetry(policy, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	assert.NoError(t, worker.Wait())
+	assert.Equal(t, 3, calls)
+
+	worker.RunTaskWithRetry(policy, func(ctx context.Context) error {
+		return errors.New("down")
+	})
+	assert.EqualError(t, worker.Wait(), "down")
+}